@@ -2,7 +2,10 @@ package browscap
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
+	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/jmoiron/sqlx"
 	"iter"
@@ -10,20 +13,43 @@ import (
 	"sync/atomic"
 )
 
+const browserSelectColumns = `
+	id, parent, pattern, comment, browser, browser_type, browser_bits, browser_maker, browser_modus,
+	version, major_ver, minor_ver, platform, platform_version, platform_description, platform_bits,
+	platform_maker, alpha, beta, win16, win32, win64, frames, iframes, tables, cookies, background_sounds,
+	javascript, vbscript, java_applets, activex_controls, is_mobile_device, is_tablet,
+	is_syndication_reader, crawler, is_fake, is_anonymized, is_modified, css_version, aol_version,
+	device_name, device_maker, device_type, device_pointing_method, device_code_name, device_brand_name,
+	rendering_engine_name, rendering_engine_version, rendering_engine_description, rendering_engine_maker`
+
+var browserInsertColumns = []string{"id", "hash", "parent", "pattern", "comment", "browser", "browser_type",
+	"browser_bits", "browser_maker", "browser_modus", "version", "major_ver", "minor_ver", "platform",
+	"platform_version", "platform_description", "platform_bits", "platform_maker", "alpha", "beta", "win16", "win32",
+	"win64", "frames", "iframes", "tables", "cookies", "background_sounds", "javascript", "vbscript", "java_applets",
+	"activex_controls", "is_mobile_device", "is_tablet", "is_syndication_reader", "crawler", "is_fake",
+	"is_anonymized", "is_modified", "css_version", "aol_version", "device_name", "device_maker", "device_type",
+	"device_pointing_method", "device_code_name", "device_brand_name", "rendering_engine_name",
+	"rendering_engine_version", "rendering_engine_description", "rendering_engine_maker",
+}
+
+// DefaultBatchSize is the number of rows AbstractDBStorage inserts at once while compiling.
+const DefaultBatchSize = 500
+
 type MetaQuoter interface {
 	QuoteMeta(string) string
 }
 
+// Inserter inserts rows, holding values in the order of columns, within the compile transaction.
 type Inserter interface {
-	InsertIgnore(table string, columns []string, data any) error
+	InsertIgnore(ctx context.Context, tx *sqlx.Tx, table string, columns []string, rows [][]any) error
 }
 
 type TableExistenceChecker interface {
-	TableExists(table string) (bool, error)
+	TableExists(ctx context.Context, table string) (bool, error)
 }
 
 type TableCreator interface {
-	CreateTable(name string, columns string) error
+	CreateTable(ctx context.Context, name string, columns string) error
 }
 
 type PlaceholderMaker interface {
@@ -52,9 +78,26 @@ func (n *NumberedPlaceholderMaker) MakePlaceholder(from int) string {
 	return "$" + strconv.Itoa(from+1)
 }
 
+// AbstractDBStorage keeps every compile in its own generation of the browser table, e.g. browser_3. The generation
+// table holds a row per generation with its version and points at the active one, which is flipped only once a
+// compile has completed, so readers never see a partially populated table. Rows of a compile are inserted in
+// batches within a single transaction.
+//
+// Databases compiled before generations were introduced hold a single browser table along with a version table.
+// They are served as the legacy generation until the first compile activates a new one, and dropped by Prune.
+//
+// Reads go to the active generation, which is looked up on every call. Browscaps created by a Loader read through a
+// view returned by Pin instead, so they skip the lookup and keep reading the generation their tree was built from
+// after a newer one has been activated.
 type AbstractDBStorage struct {
 	db                    *sqlx.DB
 	incrementCounter      int32
+	generationTable       atomic.Bool
+	compiling             int64
+	tx                    *sqlx.Tx
+	batchSize             int
+	pending               [][]any
+	saved                 map[string]string
 	inserter              Inserter
 	metaQuoter            MetaQuoter
 	tableExistenceChecker TableExistenceChecker
@@ -77,18 +120,143 @@ func NewAbstractDBStorage(
 		tableExistenceChecker: tableExistenceChecker,
 		tableCreator:          tableCreator,
 		placeholderMaker:      placeholderMaker,
+		batchSize:             DefaultBatchSize,
+	}
+}
+
+// SetBatchSize sets the number of rows inserted at once while compiling. Keep in mind that databases limit the
+// number of placeholders of a single statement.
+func (s *AbstractDBStorage) SetBatchSize(size int) {
+	s.batchSize = max(size, 1)
+}
+
+// legacyGeneration is the generation of databases compiled before generations were introduced.
+const legacyGeneration = 0
+
+func (s *AbstractDBStorage) browserTable(generation int64) string {
+	if generation == legacyGeneration {
+		return "browser"
+	}
+
+	return fmt.Sprintf("browser_%d", generation)
+}
+
+// legacyExists reports whether the database holds the tables of the legacy generation.
+func (s *AbstractDBStorage) legacyExists(ctx context.Context) (bool, error) {
+	for _, table := range []string{"version", "browser"} {
+		exists, err := s.tableExistenceChecker.TableExists(ctx, table)
+		if err != nil {
+			return false, fmt.Errorf("error checking %s table: %w", table, err)
+		}
+
+		if !exists {
+			return false, nil
+		}
 	}
+
+	return true, nil
+}
+
+// generationTableExists checks for the generation table until it has been found, it is never dropped afterwards.
+func (s *AbstractDBStorage) generationTableExists(ctx context.Context) (bool, error) {
+	if s.generationTable.Load() {
+		return true, nil
+	}
+
+	exists, err := s.tableExistenceChecker.TableExists(ctx, "generation")
+	if err != nil {
+		return false, fmt.Errorf("error checking generation table: %w", err)
+	}
+
+	if exists {
+		s.generationTable.Store(true)
+	}
+
+	return exists, nil
+}
+
+func (s *AbstractDBStorage) activeGeneration(ctx context.Context) (int64, error) {
+	exists, err := s.generationTableExists(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if exists {
+		var generation int64
+		err = s.db.GetContext(
+			ctx,
+			&generation,
+			fmt.Sprintf(`SELECT generation FROM generation WHERE active = %s`, s.placeholderMaker.MakePlaceholder(0)),
+			true,
+		)
+		if err == nil {
+			return generation, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("error getting active generation: %w", err)
+		}
+	}
+
+	legacy, err := s.legacyExists(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if !legacy {
+		return 0, ErrEmptyCache
+	}
+
+	return legacyGeneration, nil
+}
+
+func (s *AbstractDBStorage) Pin() (BrowserStorage, int64, error) {
+	return s.PinContext(context.Background())
+}
+
+// PinContext returns a view of the active generation.
+func (s *AbstractDBStorage) PinContext(ctx context.Context) (BrowserStorage, int64, error) {
+	generation, err := s.activeGeneration(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return &dbGeneration{
+		AbstractDBStorage: s,
+		generation:        generation,
+	}, generation, nil
 }
 
 func (s *AbstractDBStorage) Patterns() iter.Seq2[string, error] {
+	return s.PatternsContext(context.Background())
+}
+
+func (s *AbstractDBStorage) PatternsContext(ctx context.Context) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		generation, err := s.activeGeneration(ctx)
+		if err != nil {
+			yield("", fmt.Errorf("error getting patterns: %w", err))
+			return
+		}
+
+		for pattern, err := range s.patterns(ctx, generation) {
+			if !yield(pattern, err) {
+				return
+			}
+		}
+	}
+}
+
+func (s *AbstractDBStorage) patterns(ctx context.Context, generation int64) iter.Seq2[string, error] {
 	return func(yield func(string, error) bool) {
 		from := 0
 		batchSize := 500
 
 		for {
-			rows, err := s.db.Queryx(
+			rows, err := s.db.QueryxContext(
+				ctx,
 				fmt.Sprintf(
-					`SELECT id, pattern FROM browser WHERE id > %s ORDER BY id LIMIT %s`,
+					`SELECT id, pattern FROM %s WHERE id > %s ORDER BY id LIMIT %s`,
+					s.browserTable(generation),
 					s.placeholderMaker.MakePlaceholder(0),
 					s.placeholderMaker.MakePlaceholder(1),
 				),
@@ -138,41 +306,174 @@ func (s *AbstractDBStorage) hash(pattern string) string {
 }
 
 func (s *AbstractDBStorage) SaveVersion(ver *Version) error {
-	_, err := s.db.NamedExec(`INSERT INTO version (version, type) VALUES (:version, :type)`, ver)
+	return s.SaveVersionContext(context.Background(), ver)
+}
+
+// SaveVersionContext completes the compile by making its generation the active one and committing it.
+func (s *AbstractDBStorage) SaveVersionContext(ctx context.Context, ver *Version) error {
+	if s.tx == nil {
+		return fmt.Errorf("storage is not prepared")
+	}
+
+	err := s.flush(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx := s.tx
+
+	_, err = tx.ExecContext(
+		ctx,
+		fmt.Sprintf(
+			`UPDATE generation SET active = %s WHERE active = %s`,
+			s.placeholderMaker.MakePlaceholder(0),
+			s.placeholderMaker.MakePlaceholder(1),
+		),
+		false,
+		true,
+	)
+	if err != nil {
+		return fmt.Errorf("error deactivating generation: %w", err)
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		fmt.Sprintf(
+			`UPDATE generation SET version = %s, type = %s, active = %s WHERE generation = %s`,
+			s.placeholderMaker.MakePlaceholder(0),
+			s.placeholderMaker.MakePlaceholder(1),
+			s.placeholderMaker.MakePlaceholder(2),
+			s.placeholderMaker.MakePlaceholder(3),
+		),
+		ver.Version,
+		ver.Type,
+		true,
+		s.compiling,
+	)
 	if err != nil {
 		return fmt.Errorf("error saving version: %w", err)
 	}
 
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("error committing version: %w", err)
+	}
+
+	s.compiling = 0
+	s.tx = nil
+	s.saved = nil
+
 	return nil
 }
 
 func (s *AbstractDBStorage) Get(pattern string) (*BrowserNode, error) {
+	return s.GetContext(context.Background(), pattern)
+}
+
+func (s *AbstractDBStorage) GetContext(ctx context.Context, pattern string) (*BrowserNode, error) {
+	generation, err := s.activeGeneration(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting node: %w", err)
+	}
+
+	return s.get(ctx, generation, pattern)
+}
+
+func (s *AbstractDBStorage) get(ctx context.Context, generation int64, pattern string) (*BrowserNode, error) {
 	hash := s.hash(pattern)
 
 	node := new(BrowserNode)
-	err := s.db.Get(
+	err := s.db.GetContext(
+		ctx,
 		node,
-		fmt.Sprintf(`
-			SELECT
-				id, parent, pattern, comment, browser, browser_type, browser_bits, browser_maker, browser_modus,
-				version, major_ver, minor_ver, platform, platform_version, platform_description, platform_bits,
-				platform_maker, alpha, beta, win16, win32, win64, frames, iframes, tables, cookies, background_sounds,
-				javascript, vbscript, java_applets, activex_controls, is_mobile_device, is_tablet,
-				is_syndication_reader, crawler, is_fake, is_anonymized, is_modified, css_version, aol_version,
-				device_name, device_maker, device_type, device_pointing_method, device_code_name, device_brand_name,
-				rendering_engine_name, rendering_engine_version, rendering_engine_description, rendering_engine_maker
-			FROM browser WHERE hash = %s`,
+		fmt.Sprintf(
+			`SELECT %s FROM %s WHERE hash = %s`,
+			browserSelectColumns,
+			s.browserTable(generation),
 			s.placeholderMaker.MakePlaceholder(0),
 		),
 		hash,
 	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPatternNotFound
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error getting node: %w", err)
 	}
 
+	if node.Pattern != pattern {
+		return nil, ErrPatternNotFound
+	}
+
 	return node, nil
 }
 
+func (s *AbstractDBStorage) GetMany(patterns []string) (map[string]*BrowserNode, error) {
+	return s.GetManyContext(context.Background(), patterns)
+}
+
+func (s *AbstractDBStorage) GetManyContext(ctx context.Context, patterns []string) (map[string]*BrowserNode, error) {
+	generation, err := s.activeGeneration(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting nodes: %w", err)
+	}
+
+	return s.getMany(ctx, generation, patterns)
+}
+
+func (s *AbstractDBStorage) getMany(
+	ctx context.Context,
+	generation int64,
+	patterns []string,
+) (map[string]*BrowserNode, error) {
+	requested := make(map[string]struct{}, len(patterns))
+	for _, pattern := range patterns {
+		requested[pattern] = struct{}{}
+	}
+
+	res := make(map[string]*BrowserNode, len(patterns))
+	batchSize := 500
+
+	for from := 0; from < len(patterns); from += batchSize {
+		batch := patterns[from:min(from+batchSize, len(patterns))]
+
+		placeholders := bytes.NewBufferString("")
+		args := make([]any, len(batch))
+		for i, pattern := range batch {
+			if i > 0 {
+				placeholders.WriteString(", ")
+			}
+			placeholders.WriteString(s.placeholderMaker.MakePlaceholder(i))
+			args[i] = s.hash(pattern)
+		}
+
+		var nodes []*BrowserNode
+		err := s.db.SelectContext(
+			ctx,
+			&nodes,
+			fmt.Sprintf(
+				`SELECT %s FROM %s WHERE hash IN (%s)`,
+				browserSelectColumns,
+				s.browserTable(generation),
+				placeholders.String(),
+			),
+			args...,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error getting nodes: %w", err)
+		}
+
+		for _, node := range nodes {
+			// a node sharing the hash of a requested pattern is not the requested one
+			if _, ok := requested[node.Pattern]; ok {
+				res[node.Pattern] = node
+			}
+		}
+	}
+
+	return res, nil
+}
+
 func (s *AbstractDBStorage) columnsToSql(columns []string) string {
 	buf := bytes.NewBufferString("")
 	for i, column := range columns {
@@ -185,64 +486,114 @@ func (s *AbstractDBStorage) columnsToSql(columns []string) string {
 	return buf.String()
 }
 
-func (*AbstractDBStorage) columnsToPlaceholders(columns []string) string {
+// rowsToPlaceholders returns the VALUES list of a multi-row insert along with its flattened arguments.
+func (s *AbstractDBStorage) rowsToPlaceholders(rows [][]any) (string, []any) {
 	buf := bytes.NewBufferString("")
-	for i, column := range columns {
+	args := make([]any, 0, len(rows)*len(browserInsertColumns))
+
+	for i, row := range rows {
 		if i > 0 {
 			buf.WriteString(", ")
 		}
-		buf.WriteString(":")
-		buf.WriteString(column)
+		buf.WriteString("(")
+		for j, v := range row {
+			if j > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString(s.placeholderMaker.MakePlaceholder(len(args)))
+			args = append(args, v)
+		}
+		buf.WriteString(")")
 	}
 
-	return buf.String()
+	return buf.String(), args
 }
 
 func (s *AbstractDBStorage) Save(node *BrowserNode) error {
+	return s.SaveContext(context.Background(), node)
+}
+
+func (s *AbstractDBStorage) SaveContext(ctx context.Context, node *BrowserNode) error {
+	if s.tx == nil {
+		return fmt.Errorf("storage is not prepared")
+	}
+
+	hash := s.hash(node.Pattern)
+	if saved, ok := s.saved[hash]; ok {
+		if saved != node.Pattern {
+			return fmt.Errorf("%w: %s and %s", ErrHashCollision, saved, node.Pattern)
+		}
+
+		return nil
+	}
+	s.saved[hash] = node.Pattern
+
 	id := atomic.AddInt32(&s.incrementCounter, 1)
 
-	n := &struct {
-		ID   int    `db:"id"`
-		Hash string `db:"hash"`
-		*BrowserNode
-	}{
-		ID:          int(id),
-		Hash:        s.hash(node.Pattern),
-		BrowserNode: node,
-	}
-
-	err := s.inserter.InsertIgnore(
-		"browser",
-		[]string{"id", "hash", "parent", "pattern", "comment", "browser", "browser_type", "browser_bits",
-			"browser_maker", "browser_modus", "version", "major_ver", "minor_ver", "platform", "platform_version",
-			"platform_description", "platform_bits", "platform_maker", "alpha", "beta", "win16", "win32", "win64",
-			"frames", "iframes", "tables", "cookies", "background_sounds", "javascript", "vbscript", "java_applets",
-			"activex_controls", "is_mobile_device", "is_tablet", "is_syndication_reader", "crawler", "is_fake",
-			"is_anonymized", "is_modified", "css_version", "aol_version", "device_name", "device_maker", "device_type",
-			"device_pointing_method", "device_code_name", "device_brand_name", "rendering_engine_name",
-			"rendering_engine_version", "rendering_engine_description", "rendering_engine_maker",
-		},
-		n,
-	)
+	s.pending = append(s.pending, []any{
+		id, hash, node.Parent, node.Pattern, node.Comment, node.Browser, node.BrowserType, node.BrowserBits,
+		node.BrowserMaker, node.BrowserModus, node.Version, node.MajorVer, node.MinorVer, node.Platform,
+		node.PlatformVersion, node.PlatformDescription, node.PlatformBits, node.PlatformMaker, node.Alpha, node.Beta,
+		node.Win16, node.Win32, node.Win64, node.Frames, node.Iframes, node.Tables, node.Cookies,
+		node.BackgroundSounds, node.Javascript, node.VBScript, node.JavaApplets, node.ActiveXControls,
+		node.IsMobileDevice, node.IsTablet, node.IsSyndicationReader, node.Crawler, node.IsFake, node.IsAnonymized,
+		node.IsModified, node.CSSVersion, node.AolVersion, node.DeviceName, node.DeviceMaker, node.DeviceType,
+		node.DevicePointingMethod, node.DeviceCodeName, node.DeviceBrandName, node.RenderingEngineName,
+		node.RenderingEngineVersion, node.RenderingEngineDescription, node.RenderingEngineMaker,
+	})
+
+	if len(s.pending) < s.batchSize {
+		return nil
+	}
+
+	return s.flush(ctx)
+}
+
+func (s *AbstractDBStorage) flush(ctx context.Context) error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+
+	err := s.inserter.InsertIgnore(ctx, s.tx, s.browserTable(s.compiling), browserInsertColumns, s.pending)
 	if err != nil {
-		return fmt.Errorf("error saving node: %w", err)
+		return fmt.Errorf("error saving nodes: %w", err)
 	}
 
+	s.pending = s.pending[:0]
+
 	return nil
 }
 
 func (s *AbstractDBStorage) GetVersion() (*Version, error) {
-	versionExists, err := s.tableExistenceChecker.TableExists("version")
+	return s.GetVersionContext(context.Background())
+}
+
+func (s *AbstractDBStorage) GetVersionContext(ctx context.Context) (*Version, error) {
+	generation, err := s.activeGeneration(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("error checking version table: %w", err)
+		return nil, err
 	}
 
-	if !versionExists {
-		return nil, ErrEmptyCache
-	}
+	return s.generationVersion(ctx, generation)
+}
 
+func (s *AbstractDBStorage) generationVersion(ctx context.Context, generation int64) (*Version, error) {
 	ver := new(Version)
-	err = s.db.Get(ver, "SELECT version, type FROM version")
+
+	var err error
+	if generation == legacyGeneration {
+		err = s.db.GetContext(ctx, ver, `SELECT version, type FROM version`)
+	} else {
+		err = s.db.GetContext(
+			ctx,
+			ver,
+			fmt.Sprintf(`SELECT version, type FROM generation WHERE generation = %s`, s.placeholderMaker.MakePlaceholder(0)),
+			generation,
+		)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrEmptyCache
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error getting version: %w", err)
 	}
@@ -250,22 +601,37 @@ func (s *AbstractDBStorage) GetVersion() (*Version, error) {
 	return ver, nil
 }
 
-func (s *AbstractDBStorage) createVersionTable() error {
-	err := s.tableCreator.CreateTable(
-		"version",
-		`version INT NOT NULL,
-		type VARCHAR(255) NOT NULL`,
+func (s *AbstractDBStorage) createGenerationTable(ctx context.Context) error {
+	exists, err := s.generationTableExists(ctx)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return nil
+	}
+
+	err = s.tableCreator.CreateTable(
+		ctx,
+		"generation",
+		`generation INT NOT NULL PRIMARY KEY,
+		version INT NOT NULL,
+		type VARCHAR(255) NOT NULL,
+		active BOOL NOT NULL`,
 	)
 	if err != nil {
-		return fmt.Errorf("error creating version table: %w", err)
+		return fmt.Errorf("error creating generation table: %w", err)
 	}
 
-	return err
+	s.generationTable.Store(true)
+
+	return nil
 }
 
-func (s *AbstractDBStorage) createBrowserTable() error {
+func (s *AbstractDBStorage) createBrowserTable(ctx context.Context, name string) error {
 	err := s.tableCreator.CreateTable(
-		"browser",
+		ctx,
+		name,
 		`id INT NOT NULL PRIMARY KEY,
 		hash CHAR(32) NOT NULL UNIQUE,
 		parent VARCHAR(255) NOT NULL,
@@ -326,17 +692,233 @@ func (s *AbstractDBStorage) createBrowserTable() error {
 }
 
 func (s *AbstractDBStorage) Prepare() error {
-	var err error
+	return s.PrepareContext(context.Background())
+}
 
-	err = s.createVersionTable()
+func (s *AbstractDBStorage) dropTable(ctx context.Context, name string) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS %s`, s.metaQuoter.QuoteMeta(name)))
 	if err != nil {
-		return fmt.Errorf("error creating version table: %w", err)
+		return fmt.Errorf("error dropping %s table: %w", name, err)
 	}
 
-	err = s.createBrowserTable()
+	return nil
+}
+
+// PrepareContext starts a new generation. The active one keeps serving reads until SaveVersion.
+func (s *AbstractDBStorage) PrepareContext(ctx context.Context) error {
+	err := s.RollbackContext(ctx)
+	if err != nil {
+		return fmt.Errorf("error discarding previous compile: %w", err)
+	}
+
+	err = s.createGenerationTable(ctx)
+	if err != nil {
+		return fmt.Errorf("error creating generation table: %w", err)
+	}
+
+	var generation int64
+	err = s.db.GetContext(ctx, &generation, `SELECT COALESCE(MAX(generation), 0) + 1 FROM generation`)
+	if err != nil {
+		return fmt.Errorf("error getting next generation: %w", err)
+	}
+
+	_, err = s.db.ExecContext(
+		ctx,
+		fmt.Sprintf(
+			`INSERT INTO generation (generation, version, type, active) VALUES (%s, %s, %s, %s)`,
+			s.placeholderMaker.MakePlaceholder(0),
+			s.placeholderMaker.MakePlaceholder(1),
+			s.placeholderMaker.MakePlaceholder(2),
+			s.placeholderMaker.MakePlaceholder(3),
+		),
+		generation,
+		0,
+		"",
+		false,
+	)
+	if err != nil {
+		return fmt.Errorf("error registering generation: %w", err)
+	}
+
+	// a failed compile may have left the table behind
+	err = s.dropTable(ctx, s.browserTable(generation))
+	if err != nil {
+		return err
+	}
+
+	err = s.createBrowserTable(ctx, s.browserTable(generation))
 	if err != nil {
 		return fmt.Errorf("error creating browser table: %w", err)
 	}
 
+	s.tx, err = s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	s.compiling = generation
+	s.pending = nil
+	s.saved = make(map[string]string)
+	atomic.StoreInt32(&s.incrementCounter, 0)
+
 	return nil
 }
+
+func (s *AbstractDBStorage) Rollback() error {
+	return s.RollbackContext(context.Background())
+}
+
+// RollbackContext discards the compile in progress along with its generation.
+func (s *AbstractDBStorage) RollbackContext(ctx context.Context) error {
+	if s.tx != nil {
+		err := s.tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			return fmt.Errorf("error rolling back transaction: %w", err)
+		}
+	}
+
+	s.tx = nil
+	s.pending = nil
+	s.saved = nil
+
+	if s.compiling == 0 {
+		return nil
+	}
+
+	err := s.dropTable(ctx, s.browserTable(s.compiling))
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(
+		ctx,
+		fmt.Sprintf(`DELETE FROM generation WHERE generation = %s`, s.placeholderMaker.MakePlaceholder(0)),
+		s.compiling,
+	)
+	if err != nil {
+		return fmt.Errorf("error deleting generation %d: %w", s.compiling, err)
+	}
+
+	s.compiling = 0
+
+	return nil
+}
+
+func (s *AbstractDBStorage) Prune(keep int) error {
+	return s.PruneContext(context.Background(), keep)
+}
+
+// PruneContext drops generations older than the active one, keeping the keep most recent complete ones for
+// processes that have not reloaded yet.
+func (s *AbstractDBStorage) PruneContext(ctx context.Context, keep int) error {
+	active, err := s.activeGeneration(ctx)
+	if err != nil {
+		return fmt.Errorf("error pruning: %w", err)
+	}
+
+	if active == legacyGeneration {
+		return nil
+	}
+
+	var generations []struct {
+		Generation int64 `db:"generation"`
+		Version    int   `db:"version"`
+	}
+	err = s.db.SelectContext(
+		ctx,
+		&generations,
+		fmt.Sprintf(
+			`SELECT generation, version FROM generation WHERE generation < %s ORDER BY generation DESC`,
+			s.placeholderMaker.MakePlaceholder(0),
+		),
+		active,
+	)
+	if err != nil {
+		return fmt.Errorf("error getting generations: %w", err)
+	}
+
+	for _, g := range generations {
+		// incomplete generations are leftovers of failed compiles
+		if g.Version > 0 && keep > 0 {
+			keep--
+			continue
+		}
+
+		err = s.dropTable(ctx, s.browserTable(g.Generation))
+		if err != nil {
+			return err
+		}
+
+		_, err = s.db.ExecContext(
+			ctx,
+			fmt.Sprintf(`DELETE FROM generation WHERE generation = %s`, s.placeholderMaker.MakePlaceholder(0)),
+			g.Generation,
+		)
+		if err != nil {
+			return fmt.Errorf("error deleting generation %d: %w", g.Generation, err)
+		}
+	}
+
+	legacy, err := s.legacyExists(ctx)
+	if err != nil {
+		return fmt.Errorf("error pruning: %w", err)
+	}
+
+	// the legacy generation is older than any other one
+	if !legacy || keep > 0 {
+		return nil
+	}
+
+	err = s.dropTable(ctx, s.browserTable(legacyGeneration))
+	if err != nil {
+		return err
+	}
+
+	return s.dropTable(ctx, "version")
+}
+
+// dbGeneration is a view of a single generation of an AbstractDBStorage. Compiles go to the storage as usual.
+type dbGeneration struct {
+	*AbstractDBStorage
+	generation int64
+}
+
+func (g *dbGeneration) Pin() (BrowserStorage, int64, error) {
+	return g, g.generation, nil
+}
+
+func (g *dbGeneration) PinContext(context.Context) (BrowserStorage, int64, error) {
+	return g, g.generation, nil
+}
+
+func (g *dbGeneration) GetVersion() (*Version, error) {
+	return g.GetVersionContext(context.Background())
+}
+
+func (g *dbGeneration) GetVersionContext(ctx context.Context) (*Version, error) {
+	return g.generationVersion(ctx, g.generation)
+}
+
+func (g *dbGeneration) Get(pattern string) (*BrowserNode, error) {
+	return g.GetContext(context.Background(), pattern)
+}
+
+func (g *dbGeneration) GetContext(ctx context.Context, pattern string) (*BrowserNode, error) {
+	return g.get(ctx, g.generation, pattern)
+}
+
+func (g *dbGeneration) GetMany(patterns []string) (map[string]*BrowserNode, error) {
+	return g.GetManyContext(context.Background(), patterns)
+}
+
+func (g *dbGeneration) GetManyContext(ctx context.Context, patterns []string) (map[string]*BrowserNode, error) {
+	return g.getMany(ctx, g.generation, patterns)
+}
+
+func (g *dbGeneration) Patterns() iter.Seq2[string, error] {
+	return g.PatternsContext(context.Background())
+}
+
+func (g *dbGeneration) PatternsContext(ctx context.Context) iter.Seq2[string, error] {
+	return g.patterns(ctx, g.generation)
+}
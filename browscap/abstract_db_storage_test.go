@@ -0,0 +1,360 @@
+package browscap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/magiconair/properties/assert"
+	"strings"
+	"testing"
+)
+
+func TestGenerationSwap(t *testing.T) {
+	db := openSqlite(t)
+
+	storage := NewSqliteBrowserStorage(db)
+
+	err := NewLoader(storage).CompileReader(bytes.NewReader(fixtureWithVersion(t, "6001007")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a compile in progress must not be visible to readers
+	err = storage.Prepare()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = storage.Save(&BrowserNode{Pattern: DefaultPatternName})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ver, err := storage.GetVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, ver.Version, 6001007)
+
+	bc, err := NewLoader(storage).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := bc.GetBrowser(testUserAgent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, b.Browser, "Chrome")
+
+	// the next compile discards the one left open and reuses its generation
+	err = NewLoader(storage, WithRecompile(RecompileNewer)).
+		CompileReader(bytes.NewReader(fixtureWithVersion(t, "6001008")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ver, err = storage.GetVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, ver.Version, 6001008)
+
+	tableExists := func(name string) bool {
+		exists, err := storage.TableExists(context.Background(), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return exists
+	}
+
+	assert.Equal(t, tableExists("browser_1"), true)
+	assert.Equal(t, tableExists("browser_2"), true)
+	assert.Equal(t, tableExists("browser_3"), false)
+
+	err = storage.Prune(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, tableExists("browser_1"), false)
+	assert.Equal(t, tableExists("browser_2"), true)
+
+	bc, err = NewLoader(storage).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err = bc.GetBrowser(testUserAgent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, b.Browser, "Chrome")
+}
+
+func TestCompileRollback(t *testing.T) {
+	db := openSqlite(t)
+
+	storage := NewSqliteBrowserStorage(db)
+	storage.SetBatchSize(7)
+
+	err := NewLoader(storage).CompileReader(bytes.NewReader(fixtureWithVersion(t, "6001007")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	err = db.Get(&count, "SELECT COUNT(*) FROM browser_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, count, 9977)
+
+	broken := append(fixtureWithVersion(t, "6001008"), []byte("\n[Broken]\nBrowser_Bits=\"abc\"\n")...)
+	err = NewLoader(storage, WithRecompile(RecompileNewer)).CompileReader(bytes.NewReader(broken))
+	if err == nil {
+		t.Fatal("expected error compiling broken file")
+	}
+
+	ver, err := storage.GetVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, ver.Version, 6001007)
+
+	err = db.Get(&count, "SELECT COUNT(*) FROM generation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, count, 1)
+
+	exists, err := storage.TableExists(context.Background(), "browser_2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, exists, false)
+}
+
+func TestPrepareDiscardsOpenCompile(t *testing.T) {
+	db := openSqlite(t)
+
+	storage := NewSqliteBrowserStorage(db)
+	storage.SetBatchSize(1)
+
+	err := storage.Prepare()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the row is written within the compile transaction, which holds the write lock
+	err = storage.Save(&BrowserNode{Pattern: DefaultPatternName})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = storage.Prepare()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = storage.Save(&BrowserNode{Pattern: DefaultPatternName})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = storage.SaveVersion(&Version{Version: 6001007, Type: "LITE"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ver, err := storage.GetVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, ver.Version, 6001007)
+
+	var count int
+	err = db.Get(&count, "SELECT COUNT(*) FROM generation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, count, 1)
+}
+
+type countingTableExistenceChecker struct {
+	TableExistenceChecker
+	calls int
+}
+
+func (c *countingTableExistenceChecker) TableExists(ctx context.Context, table string) (bool, error) {
+	c.calls++
+	return c.TableExistenceChecker.TableExists(ctx, table)
+}
+
+func TestGenerationTableChecked(t *testing.T) {
+	db := openSqlite(t)
+
+	storage := NewSqliteBrowserStorage(db)
+	checker := &countingTableExistenceChecker{TableExistenceChecker: storage}
+	storage.tableExistenceChecker = checker
+
+	_, err := storage.GetVersion()
+	if !errors.Is(err, ErrEmptyCache) {
+		t.Fatalf("expected ErrEmptyCache, got %v", err)
+	}
+
+	err = NewLoader(storage).CompileReader(bytes.NewReader(fixtureWithVersion(t, "6001007")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checker.calls = 0
+
+	for range 3 {
+		_, err = storage.Get(DefaultPatternName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = storage.GetVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, checker.calls, 0)
+}
+
+func TestLegacySchema(t *testing.T) {
+	db := openSqlite(t)
+
+	err := NewLoader(NewSqliteBrowserStorage(db)).CompileReader(bytes.NewReader(fixtureWithVersion(t, "6001007")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// turn it into a database compiled before generations were introduced
+	for _, query := range []string{
+		`ALTER TABLE browser_1 RENAME TO browser`,
+		`DROP TABLE generation`,
+		`CREATE TABLE version (version INT NOT NULL, type VARCHAR(255) NOT NULL)`,
+		`INSERT INTO version (version, type) VALUES (6001007, 'LITE')`,
+	} {
+		db.MustExec(query)
+	}
+
+	storage := NewSqliteBrowserStorage(db)
+
+	assertBrowser := func() {
+		bc, err := NewLoader(storage).Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := bc.GetBrowser(testUserAgent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, b.Browser, "Chrome")
+	}
+
+	ver, err := storage.GetVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, *ver, Version{Version: 6001007, Type: "LITE"})
+
+	assertBrowser()
+
+	err = NewLoader(storage, WithRecompile(RecompileForce)).
+		CompileReader(bytes.NewReader(fixtureWithVersion(t, "6001007")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertBrowser()
+
+	tableExists := func(name string) bool {
+		exists, err := storage.TableExists(context.Background(), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return exists
+	}
+
+	err = storage.Prune(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, tableExists("browser"), true)
+
+	err = storage.Prune(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, tableExists("browser"), false)
+	assert.Equal(t, tableExists("version"), false)
+	assert.Equal(t, tableExists("browser_1"), true)
+
+	assertBrowser()
+}
+
+func TestGenerationPinned(t *testing.T) {
+	storage := NewSqliteBrowserStorage(openSqlite(t))
+
+	err := NewLoader(storage).CompileReader(bytes.NewReader(fixtureWithVersion(t, "6001007")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bc, err := NewLoader(storage).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the new version knows nothing about Chrome
+	err = NewLoader(storage, WithRecompile(RecompileNewer)).CompileReader(strings.NewReader(`
+[GJK_Browscap_Version]
+Version=6001008
+Format=php
+Type=LITE
+
+[DefaultProperties]
+Browser="DefaultProperties"
+
+[*]
+Parent="DefaultProperties"
+Browser="Default Browser"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := bc.GetBrowser(testUserAgent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, b.Browser, "Chrome")
+
+	browsers, errs := bc.GetBrowsers([]string{testUserAgent})
+	assert.Equal(t, errs[0], nil)
+	assert.Equal(t, browsers[0].Browser, "Chrome")
+
+	ver, err := bc.browserStorage.GetVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, ver.Version, 6001007)
+
+	reloaded, err := NewLoader(storage).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err = reloaded.GetBrowser(testUserAgent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, b.Browser, "Default Browser")
+	assert.Equal(t, reloaded.generation, bc.generation+1)
+}
@@ -1,9 +1,11 @@
 package browscap
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	radix "github.com/eugeniypetrov/radix-tree"
-	"reflect"
+	"go.opentelemetry.io/otel/trace"
 	"sort"
 	"strings"
 )
@@ -65,71 +67,328 @@ var ErrNotFound = fmt.Errorf("browser not found")
 type Browscap struct {
 	tree           *radix.Node
 	browserStorage BrowserStorage
+	options        *options
+	version        *Version
+	generation     int64
+	patternCount   int
 }
 
-func NewBrowscap(tree *radix.Node, browserStorage BrowserStorage) *Browscap {
+func NewBrowscap(tree *radix.Node, browserStorage BrowserStorage, opts ...Option) *Browscap {
 	return &Browscap{
 		tree:           tree,
 		browserStorage: browserStorage,
+		options:        newOptions(opts),
 	}
 }
 
-func (b *Browscap) mergeBrowsers(src, dest *BrowserNode) {
-	srcVal := reflect.ValueOf(src).Elem()
-	destVal := reflect.ValueOf(dest).Elem()
+// Version returns the version the Browscap was loaded from, nil if it was not created by a Loader.
+func (b *Browscap) Version() *Version {
+	return b.version
+}
 
-	for i := 0; i < destVal.NumField(); i++ {
-		destField := destVal.Field(i)
-		srcField := srcVal.Field(i)
+// PatternCount returns the number of patterns in the search tree, zero if it was not created by a Loader.
+func (b *Browscap) PatternCount() int {
+	return b.patternCount
+}
 
-		notSet := false
-		// for pointers, we only set if the destination is nil
-		if destField.Kind() == reflect.Ptr && destField.IsNil() && !srcField.IsNil() {
-			notSet = true
-		}
+// flattenedParent is the parent of the nodes flattened at compile time, see WithFlatten. Patterns are lower cased,
+// so it never names a real one.
+const flattenedParent = "FLATTENED"
 
-		// for values, we only set if the destination is the zero value
-		if destField.Kind() != reflect.Ptr && destField.IsZero() {
-			notSet = true
-		}
-
-		if notSet {
-			destField.Set(srcField)
-		}
-	}
+// isFlattened reports whether node was flattened at compile time and thus holds the fields of all its ancestors and
+// of the DefaultBrowser.
+func isFlattened(node *BrowserNode) bool {
+	return node.Parent == flattenedParent
 }
 
-func (b *Browscap) loadBrowserRecursive(pattern string) (*Browser, error) {
+func (b *Browscap) resolveBrowser(pattern string, get func(pattern string) (*BrowserNode, error)) (*Browser, error) {
 	res := &BrowserNode{}
 
+	child := ""
 	for {
-		browser, err := b.browserStorage.Get(pattern)
+		browser, err := get(pattern)
 		if err != nil {
+			if child != "" && errors.Is(err, ErrPatternNotFound) {
+				return nil, fmt.Errorf("%w: error getting parent %s of %s: %w", ErrBrokenParentChain, pattern, child, err)
+			}
 			return nil, fmt.Errorf("error getting browser for pattern %s: %w", pattern, err)
 		}
 
-		b.mergeBrowsers(browser, res)
+		if child == "" && isFlattened(browser) {
+			return browser.ToBrowser(), nil
+		}
+
+		mergeBrowsers(browser, res)
 
-		if pattern == DefaultPatternName {
+		if pattern == DefaultPatternName || isFlattened(browser) {
 			break
 		}
 
-		pattern = browser.Parent
+		child, pattern = pattern, browser.Parent
 	}
 
-	b.mergeBrowsers(DefaultBrowser, res)
+	mergeBrowsers(DefaultBrowser, res)
 
 	return res.ToBrowser(), nil
 }
 
-func (b *Browscap) GetBrowser(ua string) (*Browser, error) {
-	ua = strings.ToLower(ua)
+func (b *Browscap) storageGetter(ctx context.Context) func(pattern string) (*BrowserNode, error) {
+	return func(pattern string) (*BrowserNode, error) {
+		ctx, span := b.options.tracer.Start(ctx, "browscap.storage.Get",
+			trace.WithAttributes(attrPattern.String(pattern)))
+		node, err := b.browserStorage.GetContext(ctx, pattern)
+		endSpan(span, err)
+
+		return node, err
+	}
+}
+
+// rankedPatterns returns every pattern matching the lowercased user agent, best first.
+func (b *Browscap) rankedPatterns(ua string) []string {
 	patterns := b.tree.Find(ua)
 	sort.Sort(Patterns(patterns))
 
+	return patterns
+}
+
+func (b *Browscap) GetBrowser(ua string) (*Browser, error) {
+	return b.GetBrowserContext(context.Background(), ua)
+}
+
+func (b *Browscap) GetBrowserContext(ctx context.Context, ua string) (browser *Browser, err error) {
+	ctx, span := b.options.tracer.Start(ctx, "browscap.GetBrowser")
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	_, findSpan := b.options.tracer.Start(ctx, "browscap.Find")
+	patterns := b.rankedPatterns(strings.ToLower(ua))
+	findSpan.SetAttributes(attrCandidates.Int(len(patterns)))
+	findSpan.End()
+
+	span.SetAttributes(attrCandidates.Int(len(patterns)))
+
+	if len(patterns) == 0 {
+		return &Browser{}, ErrNotFound
+	}
+
+	storageGet := b.storageGetter(ctx)
+	nodesRead := 0
+	get := func(pattern string) (*BrowserNode, error) {
+		nodesRead++
+		return storageGet(pattern)
+	}
+
+	browser, err = b.resolve(patterns, get)
+
+	span.SetAttributes(attrNodesRead.Int(nodesRead))
+	if browser != nil {
+		span.SetAttributes(attrPattern.String(browser.Pattern))
+	}
+
+	return browser, err
+}
+
+// GetBrowsers resolves many user agents at once. Identical user agents are resolved only once and, when the storage
+// implements BatchBrowserStorage, all patterns of the same inheritance level are fetched in a single round trip.
+// Both returned slices are parallel to uas; errs[i] is nil when browsers[i] was resolved successfully.
+func (b *Browscap) GetBrowsers(uas []string) ([]*Browser, []error) {
+	return b.GetBrowsersContext(context.Background(), uas)
+}
+
+func (b *Browscap) GetBrowsersContext(ctx context.Context, uas []string) ([]*Browser, []error) {
+	ctx, span := b.options.tracer.Start(ctx, "browscap.GetBrowsers",
+		trace.WithAttributes(attrUserAgents.Int(len(uas))))
+	defer span.End()
+
+	browsers := make([]*Browser, len(uas))
+	errs := make([]error, len(uas))
+
+	// distinct user agent -> indexes in uas
+	distinct := make(map[string][]int)
+	for i, ua := range uas {
+		ua = strings.ToLower(ua)
+		distinct[ua] = append(distinct[ua], i)
+	}
+
+	bs, ok := b.browserStorage.(BatchBrowserStorage)
+	if !ok {
+		for ua, idx := range distinct {
+			browser, err := b.GetBrowserContext(ctx, ua)
+			for _, i := range idx {
+				browsers[i], errs[i] = browser, err
+			}
+		}
+
+		return browsers, errs
+	}
+
+	matched := make(map[string][]string, len(distinct))
+	var level []string
+	for ua, idx := range distinct {
+		patterns := b.rankedPatterns(ua)
+		if len(patterns) == 0 {
+			for _, i := range idx {
+				browsers[i], errs[i] = &Browser{}, ErrNotFound
+			}
+			continue
+		}
+
+		matched[ua] = patterns
+		level = append(level, patterns[0])
+	}
+
+	nodes, err := b.fetchAncestors(ctx, bs, level)
+	if err != nil {
+		for ua, idx := range distinct {
+			if _, ok := matched[ua]; !ok {
+				continue
+			}
+			for _, i := range idx {
+				errs[i] = err
+			}
+		}
+
+		return browsers, errs
+	}
+
+	get := b.nodeGetter(ctx, nodes)
+	for ua, patterns := range matched {
+		browser, err := b.resolve(patterns, get)
+		for _, i := range distinct[ua] {
+			browsers[i], errs[i] = browser, err
+		}
+	}
+
+	return browsers, errs
+}
+
+// nodeGetter serves prefetched nodes and falls back to the storage for the rest.
+func (b *Browscap) nodeGetter(ctx context.Context, nodes map[string]*BrowserNode) func(pattern string) (*BrowserNode, error) {
+	get := b.storageGetter(ctx)
+
+	return func(pattern string) (*BrowserNode, error) {
+		if node, ok := nodes[pattern]; ok {
+			return node, nil
+		}
+
+		return get(pattern)
+	}
+}
+
+// fetchAncestors loads the given patterns together with their whole parent chains, one storage query per
+// inheritance level.
+func (b *Browscap) fetchAncestors(
+	ctx context.Context,
+	bs BatchBrowserStorage,
+	patterns []string,
+) (map[string]*BrowserNode, error) {
+	nodes := make(map[string]*BrowserNode)
+	requested := make(map[string]bool)
+
+	level := make([]string, 0, len(patterns))
 	for _, p := range patterns {
-		return b.loadBrowserRecursive(p)
+		if !requested[p] {
+			requested[p] = true
+			level = append(level, p)
+		}
+	}
+
+	for len(level) > 0 {
+		ctx, span := b.options.tracer.Start(ctx, "browscap.storage.GetMany",
+			trace.WithAttributes(attrPatterns.Int(len(level))))
+		fetched, err := bs.GetManyContext(ctx, level)
+		endSpan(span, err)
+		if err != nil {
+			return nil, fmt.Errorf("error getting browsers: %w", err)
+		}
+
+		var next []string
+		for pattern, node := range fetched {
+			nodes[pattern] = node
+
+			if pattern == DefaultPatternName || isFlattened(node) || requested[node.Parent] {
+				continue
+			}
+
+			requested[node.Parent] = true
+			next = append(next, node.Parent)
+		}
+
+		level = next
+	}
+
+	return nodes, nil
+}
+
+// Match is a candidate pattern together with the browser it resolves to.
+type Match struct {
+	Candidate
+	Browser *Browser
+}
+
+// GetCandidates returns up to limit patterns matching ua, best first, each resolved into a Browser. The first
+// match is what GetBrowser would return. A limit of zero or less returns every match.
+func (b *Browscap) GetCandidates(ua string, limit int) ([]*Match, error) {
+	return b.GetCandidatesContext(context.Background(), ua, limit)
+}
+
+func (b *Browscap) GetCandidatesContext(ctx context.Context, ua string, limit int) ([]*Match, error) {
+	patterns := b.rankedPatterns(strings.ToLower(ua))
+	if len(patterns) == 0 {
+		return nil, ErrNotFound
+	}
+
+	res := make([]*Match, 0, max(limit, 0))
+	for len(patterns) > 0 && (limit <= 0 || len(res) < limit) {
+		// the limit counts resolved candidates, a skipped one is made up for by the next ones
+		batch := patterns
+		if limit > 0 {
+			batch = patterns[:min(len(patterns), limit-len(res))]
+		}
+		patterns = patterns[len(batch):]
+
+		matches, err := b.resolveCandidates(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, matches...)
+	}
+
+	return res, nil
+}
+
+// resolveCandidates resolves the candidates, skipping those that cannot be resolved unless the policy is strict.
+func (b *Browscap) resolveCandidates(ctx context.Context, patterns []string) ([]*Match, error) {
+	get := b.storageGetter(ctx)
+
+	if bs, ok := b.browserStorage.(BatchBrowserStorage); ok {
+		nodes, err := b.fetchAncestors(ctx, bs, patterns)
+		if err != nil {
+			return nil, err
+		}
+		get = b.nodeGetter(ctx, nodes)
+	}
+
+	res := make([]*Match, 0, len(patterns))
+	for _, p := range patterns {
+		browser, err := b.resolveBrowser(p, get)
+		if err != nil {
+			if isUnresolvable(err) && b.options.resolutionPolicy != ResolveStrict {
+				continue
+			}
+			return nil, err
+		}
+
+		res = append(res, &Match{
+			Candidate: Candidate{
+				Pattern: p,
+				Score:   patternLen(p),
+			},
+			Browser: browser,
+		})
 	}
 
-	return &Browser{}, ErrNotFound
+	return res, nil
 }
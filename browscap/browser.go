@@ -1,5 +1,7 @@
 package browscap
 
+//go:generate go run ./internal/fieldgen browser.go browser_fields.go
+
 type Browser struct {
 	Pattern                    string
 	Comment                    string
@@ -104,6 +106,12 @@ type BrowserNode struct {
 	RenderingEngineMaker       *string `mapstructure:"RenderingEngine_Maker" db:"rendering_engine_maker"`
 }
 
+// BrowserField is a field of a Browser as returned by Browser.Fields.
+type BrowserField struct {
+	Name  string
+	Value any
+}
+
 func String(v *string) string {
 	if v == nil {
 		return ""
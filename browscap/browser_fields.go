@@ -0,0 +1,481 @@
+// Code generated by fieldgen from browser.go. DO NOT EDIT.
+
+package browscap
+
+// mergeBrowsers sets every field of dest that is not set yet to the value of src.
+func mergeBrowsers(src, dest *BrowserNode) {
+	if dest.ID == 0 {
+		dest.ID = src.ID
+	}
+	if dest.Parent == "" {
+		dest.Parent = src.Parent
+	}
+	if dest.Pattern == "" {
+		dest.Pattern = src.Pattern
+	}
+	if dest.Comment == nil {
+		dest.Comment = src.Comment
+	}
+	if dest.Browser == nil {
+		dest.Browser = src.Browser
+	}
+	if dest.BrowserType == nil {
+		dest.BrowserType = src.BrowserType
+	}
+	if dest.BrowserBits == nil {
+		dest.BrowserBits = src.BrowserBits
+	}
+	if dest.BrowserMaker == nil {
+		dest.BrowserMaker = src.BrowserMaker
+	}
+	if dest.BrowserModus == nil {
+		dest.BrowserModus = src.BrowserModus
+	}
+	if dest.Version == nil {
+		dest.Version = src.Version
+	}
+	if dest.MajorVer == nil {
+		dest.MajorVer = src.MajorVer
+	}
+	if dest.MinorVer == nil {
+		dest.MinorVer = src.MinorVer
+	}
+	if dest.Platform == nil {
+		dest.Platform = src.Platform
+	}
+	if dest.PlatformVersion == nil {
+		dest.PlatformVersion = src.PlatformVersion
+	}
+	if dest.PlatformDescription == nil {
+		dest.PlatformDescription = src.PlatformDescription
+	}
+	if dest.PlatformBits == nil {
+		dest.PlatformBits = src.PlatformBits
+	}
+	if dest.PlatformMaker == nil {
+		dest.PlatformMaker = src.PlatformMaker
+	}
+	if dest.Alpha == nil {
+		dest.Alpha = src.Alpha
+	}
+	if dest.Beta == nil {
+		dest.Beta = src.Beta
+	}
+	if dest.Win16 == nil {
+		dest.Win16 = src.Win16
+	}
+	if dest.Win32 == nil {
+		dest.Win32 = src.Win32
+	}
+	if dest.Win64 == nil {
+		dest.Win64 = src.Win64
+	}
+	if dest.Frames == nil {
+		dest.Frames = src.Frames
+	}
+	if dest.Iframes == nil {
+		dest.Iframes = src.Iframes
+	}
+	if dest.Tables == nil {
+		dest.Tables = src.Tables
+	}
+	if dest.Cookies == nil {
+		dest.Cookies = src.Cookies
+	}
+	if dest.BackgroundSounds == nil {
+		dest.BackgroundSounds = src.BackgroundSounds
+	}
+	if dest.Javascript == nil {
+		dest.Javascript = src.Javascript
+	}
+	if dest.VBScript == nil {
+		dest.VBScript = src.VBScript
+	}
+	if dest.JavaApplets == nil {
+		dest.JavaApplets = src.JavaApplets
+	}
+	if dest.ActiveXControls == nil {
+		dest.ActiveXControls = src.ActiveXControls
+	}
+	if dest.IsMobileDevice == nil {
+		dest.IsMobileDevice = src.IsMobileDevice
+	}
+	if dest.IsTablet == nil {
+		dest.IsTablet = src.IsTablet
+	}
+	if dest.IsSyndicationReader == nil {
+		dest.IsSyndicationReader = src.IsSyndicationReader
+	}
+	if dest.Crawler == nil {
+		dest.Crawler = src.Crawler
+	}
+	if dest.IsFake == nil {
+		dest.IsFake = src.IsFake
+	}
+	if dest.IsAnonymized == nil {
+		dest.IsAnonymized = src.IsAnonymized
+	}
+	if dest.IsModified == nil {
+		dest.IsModified = src.IsModified
+	}
+	if dest.CSSVersion == nil {
+		dest.CSSVersion = src.CSSVersion
+	}
+	if dest.AolVersion == nil {
+		dest.AolVersion = src.AolVersion
+	}
+	if dest.DeviceName == nil {
+		dest.DeviceName = src.DeviceName
+	}
+	if dest.DeviceMaker == nil {
+		dest.DeviceMaker = src.DeviceMaker
+	}
+	if dest.DeviceType == nil {
+		dest.DeviceType = src.DeviceType
+	}
+	if dest.DevicePointingMethod == nil {
+		dest.DevicePointingMethod = src.DevicePointingMethod
+	}
+	if dest.DeviceCodeName == nil {
+		dest.DeviceCodeName = src.DeviceCodeName
+	}
+	if dest.DeviceBrandName == nil {
+		dest.DeviceBrandName = src.DeviceBrandName
+	}
+	if dest.RenderingEngineName == nil {
+		dest.RenderingEngineName = src.RenderingEngineName
+	}
+	if dest.RenderingEngineVersion == nil {
+		dest.RenderingEngineVersion = src.RenderingEngineVersion
+	}
+	if dest.RenderingEngineDescription == nil {
+		dest.RenderingEngineDescription = src.RenderingEngineDescription
+	}
+	if dest.RenderingEngineMaker == nil {
+		dest.RenderingEngineMaker = src.RenderingEngineMaker
+	}
+}
+
+// suppliedFields returns the names of the Browser fields that merging src into dest would set.
+func suppliedFields(src, dest *BrowserNode) []string {
+	var fields []string
+	if dest.Pattern == "" && !(src.Pattern == "") {
+		fields = append(fields, "Pattern")
+	}
+	if dest.Comment == nil && !(src.Comment == nil) {
+		fields = append(fields, "Comment")
+	}
+	if dest.Browser == nil && !(src.Browser == nil) {
+		fields = append(fields, "Browser")
+	}
+	if dest.BrowserType == nil && !(src.BrowserType == nil) {
+		fields = append(fields, "BrowserType")
+	}
+	if dest.BrowserBits == nil && !(src.BrowserBits == nil) {
+		fields = append(fields, "BrowserBits")
+	}
+	if dest.BrowserMaker == nil && !(src.BrowserMaker == nil) {
+		fields = append(fields, "BrowserMaker")
+	}
+	if dest.BrowserModus == nil && !(src.BrowserModus == nil) {
+		fields = append(fields, "BrowserModus")
+	}
+	if dest.Version == nil && !(src.Version == nil) {
+		fields = append(fields, "Version")
+	}
+	if dest.MajorVer == nil && !(src.MajorVer == nil) {
+		fields = append(fields, "MajorVer")
+	}
+	if dest.MinorVer == nil && !(src.MinorVer == nil) {
+		fields = append(fields, "MinorVer")
+	}
+	if dest.Platform == nil && !(src.Platform == nil) {
+		fields = append(fields, "Platform")
+	}
+	if dest.PlatformVersion == nil && !(src.PlatformVersion == nil) {
+		fields = append(fields, "PlatformVersion")
+	}
+	if dest.PlatformDescription == nil && !(src.PlatformDescription == nil) {
+		fields = append(fields, "PlatformDescription")
+	}
+	if dest.PlatformBits == nil && !(src.PlatformBits == nil) {
+		fields = append(fields, "PlatformBits")
+	}
+	if dest.PlatformMaker == nil && !(src.PlatformMaker == nil) {
+		fields = append(fields, "PlatformMaker")
+	}
+	if dest.Alpha == nil && !(src.Alpha == nil) {
+		fields = append(fields, "Alpha")
+	}
+	if dest.Beta == nil && !(src.Beta == nil) {
+		fields = append(fields, "Beta")
+	}
+	if dest.Win16 == nil && !(src.Win16 == nil) {
+		fields = append(fields, "Win16")
+	}
+	if dest.Win32 == nil && !(src.Win32 == nil) {
+		fields = append(fields, "Win32")
+	}
+	if dest.Win64 == nil && !(src.Win64 == nil) {
+		fields = append(fields, "Win64")
+	}
+	if dest.Frames == nil && !(src.Frames == nil) {
+		fields = append(fields, "Frames")
+	}
+	if dest.Iframes == nil && !(src.Iframes == nil) {
+		fields = append(fields, "Iframes")
+	}
+	if dest.Tables == nil && !(src.Tables == nil) {
+		fields = append(fields, "Tables")
+	}
+	if dest.Cookies == nil && !(src.Cookies == nil) {
+		fields = append(fields, "Cookies")
+	}
+	if dest.BackgroundSounds == nil && !(src.BackgroundSounds == nil) {
+		fields = append(fields, "BackgroundSounds")
+	}
+	if dest.Javascript == nil && !(src.Javascript == nil) {
+		fields = append(fields, "Javascript")
+	}
+	if dest.VBScript == nil && !(src.VBScript == nil) {
+		fields = append(fields, "VBScript")
+	}
+	if dest.JavaApplets == nil && !(src.JavaApplets == nil) {
+		fields = append(fields, "JavaApplets")
+	}
+	if dest.ActiveXControls == nil && !(src.ActiveXControls == nil) {
+		fields = append(fields, "ActiveXControls")
+	}
+	if dest.IsMobileDevice == nil && !(src.IsMobileDevice == nil) {
+		fields = append(fields, "IsMobileDevice")
+	}
+	if dest.IsTablet == nil && !(src.IsTablet == nil) {
+		fields = append(fields, "IsTablet")
+	}
+	if dest.IsSyndicationReader == nil && !(src.IsSyndicationReader == nil) {
+		fields = append(fields, "IsSyndicationReader")
+	}
+	if dest.Crawler == nil && !(src.Crawler == nil) {
+		fields = append(fields, "Crawler")
+	}
+	if dest.IsFake == nil && !(src.IsFake == nil) {
+		fields = append(fields, "IsFake")
+	}
+	if dest.IsAnonymized == nil && !(src.IsAnonymized == nil) {
+		fields = append(fields, "IsAnonymized")
+	}
+	if dest.IsModified == nil && !(src.IsModified == nil) {
+		fields = append(fields, "IsModified")
+	}
+	if dest.CSSVersion == nil && !(src.CSSVersion == nil) {
+		fields = append(fields, "CSSVersion")
+	}
+	if dest.AolVersion == nil && !(src.AolVersion == nil) {
+		fields = append(fields, "AolVersion")
+	}
+	if dest.DeviceName == nil && !(src.DeviceName == nil) {
+		fields = append(fields, "DeviceName")
+	}
+	if dest.DeviceMaker == nil && !(src.DeviceMaker == nil) {
+		fields = append(fields, "DeviceMaker")
+	}
+	if dest.DeviceType == nil && !(src.DeviceType == nil) {
+		fields = append(fields, "DeviceType")
+	}
+	if dest.DevicePointingMethod == nil && !(src.DevicePointingMethod == nil) {
+		fields = append(fields, "DevicePointingMethod")
+	}
+	if dest.DeviceCodeName == nil && !(src.DeviceCodeName == nil) {
+		fields = append(fields, "DeviceCodeName")
+	}
+	if dest.DeviceBrandName == nil && !(src.DeviceBrandName == nil) {
+		fields = append(fields, "DeviceBrandName")
+	}
+	if dest.RenderingEngineName == nil && !(src.RenderingEngineName == nil) {
+		fields = append(fields, "RenderingEngineName")
+	}
+	if dest.RenderingEngineVersion == nil && !(src.RenderingEngineVersion == nil) {
+		fields = append(fields, "RenderingEngineVersion")
+	}
+	if dest.RenderingEngineDescription == nil && !(src.RenderingEngineDescription == nil) {
+		fields = append(fields, "RenderingEngineDescription")
+	}
+	if dest.RenderingEngineMaker == nil && !(src.RenderingEngineMaker == nil) {
+		fields = append(fields, "RenderingEngineMaker")
+	}
+
+	return fields
+}
+
+// encodeBrowserNode encodes node into a record of the file storage and memory snapshots.
+func encodeBrowserNode(node *BrowserNode) []byte {
+	e := &nodeEncoder{}
+	e.string(node.Pattern)
+	e.int(node.ID)
+	e.string(node.Parent)
+	e.stringPtr(node.Comment)
+	e.stringPtr(node.Browser)
+	e.stringPtr(node.BrowserType)
+	e.intPtr(node.BrowserBits)
+	e.stringPtr(node.BrowserMaker)
+	e.stringPtr(node.BrowserModus)
+	e.stringPtr(node.Version)
+	e.stringPtr(node.MajorVer)
+	e.stringPtr(node.MinorVer)
+	e.stringPtr(node.Platform)
+	e.stringPtr(node.PlatformVersion)
+	e.stringPtr(node.PlatformDescription)
+	e.intPtr(node.PlatformBits)
+	e.stringPtr(node.PlatformMaker)
+	e.boolPtr(node.Alpha)
+	e.boolPtr(node.Beta)
+	e.boolPtr(node.Win16)
+	e.boolPtr(node.Win32)
+	e.boolPtr(node.Win64)
+	e.boolPtr(node.Frames)
+	e.boolPtr(node.Iframes)
+	e.boolPtr(node.Tables)
+	e.boolPtr(node.Cookies)
+	e.boolPtr(node.BackgroundSounds)
+	e.boolPtr(node.Javascript)
+	e.boolPtr(node.VBScript)
+	e.boolPtr(node.JavaApplets)
+	e.boolPtr(node.ActiveXControls)
+	e.boolPtr(node.IsMobileDevice)
+	e.boolPtr(node.IsTablet)
+	e.boolPtr(node.IsSyndicationReader)
+	e.boolPtr(node.Crawler)
+	e.boolPtr(node.IsFake)
+	e.boolPtr(node.IsAnonymized)
+	e.boolPtr(node.IsModified)
+	e.intPtr(node.CSSVersion)
+	e.intPtr(node.AolVersion)
+	e.stringPtr(node.DeviceName)
+	e.stringPtr(node.DeviceMaker)
+	e.stringPtr(node.DeviceType)
+	e.stringPtr(node.DevicePointingMethod)
+	e.stringPtr(node.DeviceCodeName)
+	e.stringPtr(node.DeviceBrandName)
+	e.stringPtr(node.RenderingEngineName)
+	e.stringPtr(node.RenderingEngineVersion)
+	e.stringPtr(node.RenderingEngineDescription)
+	e.stringPtr(node.RenderingEngineMaker)
+
+	return e.buf
+}
+
+// decodeBrowserNode decodes a record written by encodeBrowserNode.
+func decodeBrowserNode(record []byte) (*BrowserNode, error) {
+	d := &fileStorageDecoder{data: record}
+	node := &BrowserNode{}
+	node.Pattern = d.string()
+	node.ID = d.int()
+	node.Parent = d.string()
+	node.Comment = d.stringPtr()
+	node.Browser = d.stringPtr()
+	node.BrowserType = d.stringPtr()
+	node.BrowserBits = d.intPtr()
+	node.BrowserMaker = d.stringPtr()
+	node.BrowserModus = d.stringPtr()
+	node.Version = d.stringPtr()
+	node.MajorVer = d.stringPtr()
+	node.MinorVer = d.stringPtr()
+	node.Platform = d.stringPtr()
+	node.PlatformVersion = d.stringPtr()
+	node.PlatformDescription = d.stringPtr()
+	node.PlatformBits = d.intPtr()
+	node.PlatformMaker = d.stringPtr()
+	node.Alpha = d.boolPtr()
+	node.Beta = d.boolPtr()
+	node.Win16 = d.boolPtr()
+	node.Win32 = d.boolPtr()
+	node.Win64 = d.boolPtr()
+	node.Frames = d.boolPtr()
+	node.Iframes = d.boolPtr()
+	node.Tables = d.boolPtr()
+	node.Cookies = d.boolPtr()
+	node.BackgroundSounds = d.boolPtr()
+	node.Javascript = d.boolPtr()
+	node.VBScript = d.boolPtr()
+	node.JavaApplets = d.boolPtr()
+	node.ActiveXControls = d.boolPtr()
+	node.IsMobileDevice = d.boolPtr()
+	node.IsTablet = d.boolPtr()
+	node.IsSyndicationReader = d.boolPtr()
+	node.Crawler = d.boolPtr()
+	node.IsFake = d.boolPtr()
+	node.IsAnonymized = d.boolPtr()
+	node.IsModified = d.boolPtr()
+	node.CSSVersion = d.intPtr()
+	node.AolVersion = d.intPtr()
+	node.DeviceName = d.stringPtr()
+	node.DeviceMaker = d.stringPtr()
+	node.DeviceType = d.stringPtr()
+	node.DevicePointingMethod = d.stringPtr()
+	node.DeviceCodeName = d.stringPtr()
+	node.DeviceBrandName = d.stringPtr()
+	node.RenderingEngineName = d.stringPtr()
+	node.RenderingEngineVersion = d.stringPtr()
+	node.RenderingEngineDescription = d.stringPtr()
+	node.RenderingEngineMaker = d.stringPtr()
+
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	return node, nil
+}
+
+// Fields returns the names and values of all fields in declaration order.
+func (b *Browser) Fields() []BrowserField {
+	return []BrowserField{
+		{Name: "Pattern", Value: b.Pattern},
+		{Name: "Comment", Value: b.Comment},
+		{Name: "Browser", Value: b.Browser},
+		{Name: "BrowserType", Value: b.BrowserType},
+		{Name: "BrowserBits", Value: b.BrowserBits},
+		{Name: "BrowserMaker", Value: b.BrowserMaker},
+		{Name: "BrowserModus", Value: b.BrowserModus},
+		{Name: "Version", Value: b.Version},
+		{Name: "MajorVer", Value: b.MajorVer},
+		{Name: "MinorVer", Value: b.MinorVer},
+		{Name: "Platform", Value: b.Platform},
+		{Name: "PlatformVersion", Value: b.PlatformVersion},
+		{Name: "PlatformDescription", Value: b.PlatformDescription},
+		{Name: "PlatformBits", Value: b.PlatformBits},
+		{Name: "PlatformMaker", Value: b.PlatformMaker},
+		{Name: "Alpha", Value: b.Alpha},
+		{Name: "Beta", Value: b.Beta},
+		{Name: "Win16", Value: b.Win16},
+		{Name: "Win32", Value: b.Win32},
+		{Name: "Win64", Value: b.Win64},
+		{Name: "Frames", Value: b.Frames},
+		{Name: "Iframes", Value: b.Iframes},
+		{Name: "Tables", Value: b.Tables},
+		{Name: "Cookies", Value: b.Cookies},
+		{Name: "BackgroundSounds", Value: b.BackgroundSounds},
+		{Name: "Javascript", Value: b.Javascript},
+		{Name: "VBScript", Value: b.VBScript},
+		{Name: "JavaApplets", Value: b.JavaApplets},
+		{Name: "ActiveXControls", Value: b.ActiveXControls},
+		{Name: "IsMobileDevice", Value: b.IsMobileDevice},
+		{Name: "IsTablet", Value: b.IsTablet},
+		{Name: "IsSyndicationReader", Value: b.IsSyndicationReader},
+		{Name: "Crawler", Value: b.Crawler},
+		{Name: "IsFake", Value: b.IsFake},
+		{Name: "IsAnonymized", Value: b.IsAnonymized},
+		{Name: "IsModified", Value: b.IsModified},
+		{Name: "CSSVersion", Value: b.CSSVersion},
+		{Name: "AolVersion", Value: b.AolVersion},
+		{Name: "DeviceName", Value: b.DeviceName},
+		{Name: "DeviceMaker", Value: b.DeviceMaker},
+		{Name: "DeviceType", Value: b.DeviceType},
+		{Name: "DevicePointingMethod", Value: b.DevicePointingMethod},
+		{Name: "DeviceCodeName", Value: b.DeviceCodeName},
+		{Name: "DeviceBrandName", Value: b.DeviceBrandName},
+		{Name: "RenderingEngineName", Value: b.RenderingEngineName},
+		{Name: "RenderingEngineVersion", Value: b.RenderingEngineVersion},
+		{Name: "RenderingEngineDescription", Value: b.RenderingEngineDescription},
+		{Name: "RenderingEngineMaker", Value: b.RenderingEngineMaker},
+	}
+}
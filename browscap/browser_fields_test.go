@@ -0,0 +1,147 @@
+package browscap
+
+import (
+	"github.com/magiconair/properties/assert"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// reflectMergeBrowsers is the reflection based merge the generated mergeBrowsers replaced, kept as a reference.
+func reflectMergeBrowsers(src, dest *BrowserNode) {
+	srcVal := reflect.ValueOf(src).Elem()
+	destVal := reflect.ValueOf(dest).Elem()
+
+	for i := 0; i < destVal.NumField(); i++ {
+		destField := destVal.Field(i)
+		srcField := srcVal.Field(i)
+
+		notSet := false
+		// for pointers, we only set if the destination is nil
+		if destField.Kind() == reflect.Ptr && destField.IsNil() && !srcField.IsNil() {
+			notSet = true
+		}
+
+		// for values, we only set if the destination is the zero value
+		if destField.Kind() != reflect.Ptr && destField.IsZero() {
+			notSet = true
+		}
+
+		if notSet {
+			destField.Set(srcField)
+		}
+	}
+}
+
+// chain returns the nodes resolving ua goes through, the DefaultBrowser last.
+func chain(tb testing.TB, ua string) []*BrowserNode {
+	storage := NewMemoryBrowserStorage()
+	loader := NewLoader(storage)
+
+	err := loader.Compile("fixtures/lite_php_browscap.ini")
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	bc, err := loader.Load()
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	var nodes []*BrowserNode
+	pattern := bc.rankedPatterns(strings.ToLower(ua))[0]
+	for {
+		node, err := storage.Get(pattern)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		nodes = append(nodes, node)
+
+		if pattern == DefaultPatternName {
+			break
+		}
+		pattern = node.Parent
+	}
+
+	return append(nodes, DefaultBrowser)
+}
+
+func TestMergeBrowsers(t *testing.T) {
+	nodes := chain(t, testUserAgent)
+
+	expected := &BrowserNode{}
+	actual := &BrowserNode{}
+	for _, node := range nodes {
+		reflectMergeBrowsers(node, expected)
+		mergeBrowsers(node, actual)
+		assert.Equal(t, actual, expected)
+	}
+
+	b := actual.ToBrowser()
+	fields := b.Fields()
+
+	v := reflect.ValueOf(b).Elem()
+	assert.Equal(t, len(fields), v.NumField())
+	for i, f := range fields {
+		assert.Equal(t, f.Name, v.Type().Field(i).Name)
+		assert.Equal(t, f.Value, v.Field(i).Interface())
+	}
+}
+
+func TestEncodeBrowserNode(t *testing.T) {
+	for _, node := range append(chain(t, testUserAgent), &BrowserNode{}) {
+		decoded, err := decodeBrowserNode(encodeBrowserNode(node))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, decoded, node)
+	}
+
+	record := encodeBrowserNode(DefaultBrowser)
+	_, err := decodeBrowserNode(record[:len(record)-1])
+	if err == nil {
+		t.Fatal("expected error decoding truncated record")
+	}
+}
+
+func benchmarkMerge(b *testing.B, merge func(src, dest *BrowserNode)) {
+	nodes := chain(b, testUserAgent)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		res := &BrowserNode{}
+		for _, node := range nodes {
+			merge(node, res)
+		}
+		_ = res.ToBrowser()
+	}
+}
+
+func BenchmarkMergeBrowsers(b *testing.B) {
+	b.Run("reflect", func(b *testing.B) {
+		benchmarkMerge(b, reflectMergeBrowsers)
+	})
+
+	b.Run("generated", func(b *testing.B) {
+		benchmarkMerge(b, mergeBrowsers)
+	})
+}
+
+func BenchmarkGetBrowser(b *testing.B) {
+	bc, err := compileAndLoad("fixtures/lite_php_browscap.ini")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, err := bc.GetBrowser(testUserAgent)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -1,11 +1,31 @@
 package browscap
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	radix "github.com/eugeniypetrov/radix-tree"
+	"github.com/jmoiron/sqlx"
 	"github.com/magiconair/properties/assert"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
+const testUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/128.0.0.0 Safari/537.36"
+
+// openSqlite opens a fresh SQLite database closed at the end of the test.
+func openSqlite(t *testing.T) *sqlx.DB {
+	db, err := sqlx.Open("sqlite3", "file:"+filepath.Join(t.TempDir(), "browscap.sqlite")+"?_sync=OFF&_journal=MEMORY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	return db
+}
+
 func compileAndLoad(filename string) (*Browscap, error) {
 	storage := NewMemoryBrowserStorage()
 	loader := NewLoader(storage)
@@ -22,6 +42,21 @@ func compileAndLoad(filename string) (*Browscap, error) {
 	return bc, nil
 }
 
+func compileAndLoadSqlite(t *testing.T, filename string) *Browscap {
+	loader := NewLoader(NewSqliteBrowserStorage(openSqlite(t)))
+	err := loader.Compile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bc, err := loader.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bc
+}
+
 func TestGetBrowser(t *testing.T) {
 	bc, err := compileAndLoad("fixtures/lite_php_browscap.ini")
 	if err != nil {
@@ -35,3 +70,181 @@ func TestGetBrowser(t *testing.T) {
 
 	assert.Equal(t, b.Pattern, "mozilla/5.0 (*mac os x*) applewebkit* (*khtml*like*gecko*) chrome/128.0*safari/*")
 }
+
+func TestGetBrowserContextCanceled(t *testing.T) {
+	storage := NewSqliteBrowserStorage(openSqlite(t))
+
+	err := storage.Prepare()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, node := range []*BrowserNode{
+		{Pattern: DefaultPatternName},
+		{Pattern: "*", Parent: DefaultPatternName, Browser: StringPtr("Any")},
+	} {
+		err = storage.Save(node)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = storage.SaveVersion(&Version{Version: 1, Type: "TEST"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree := radix.NewRadix()
+	tree.Add("*")
+
+	bc := NewBrowscap(tree, storage)
+
+	b, err := bc.GetBrowserContext(context.Background(), "Mozilla/5.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, b.Browser, "Any")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = bc.GetBrowserContext(ctx, "Mozilla/5.0")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+// countingBatchStorage records the lookups made through it.
+type countingBatchStorage struct {
+	BrowserStorage
+	gets  int
+	batch [][]string
+}
+
+func (s *countingBatchStorage) Get(pattern string) (*BrowserNode, error) {
+	return s.GetContext(context.Background(), pattern)
+}
+
+func (s *countingBatchStorage) GetContext(ctx context.Context, pattern string) (*BrowserNode, error) {
+	s.gets++
+	return s.BrowserStorage.GetContext(ctx, pattern)
+}
+
+func (s *countingBatchStorage) GetMany(patterns []string) (map[string]*BrowserNode, error) {
+	return s.GetManyContext(context.Background(), patterns)
+}
+
+func (s *countingBatchStorage) GetManyContext(ctx context.Context, patterns []string) (map[string]*BrowserNode, error) {
+	s.batch = append(s.batch, patterns)
+	return s.BrowserStorage.(BatchBrowserStorage).GetManyContext(ctx, patterns)
+}
+
+func TestGetBrowsers(t *testing.T) {
+	bc := compileAndLoadSqlite(t, "fixtures/lite_php_browscap.ini")
+
+	uas := []string{
+		testUserAgent,
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:129.0) Gecko/20100101 Firefox/129.0",
+		testUserAgent,
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1",
+	}
+
+	// the longest inheritance chain among the user agents, one batch is expected per level
+	levels := 0
+	for _, ua := range uas {
+		e, err := bc.Explain(ua)
+		if err != nil {
+			t.Fatal(err)
+		}
+		levels = max(levels, len(e.Chain))
+	}
+
+	storage := &countingBatchStorage{BrowserStorage: bc.browserStorage}
+	batched := NewBrowscap(bc.tree, storage)
+
+	browsers, errs := batched.GetBrowsers(uas)
+	assert.Equal(t, len(browsers), len(uas))
+	assert.Equal(t, len(errs), len(uas))
+
+	assert.Equal(t, storage.gets, 0)
+	assert.Equal(t, len(storage.batch), levels)
+	assert.Equal(t, len(storage.batch[0]), 3)
+
+	requested := map[string]bool{}
+	for _, patterns := range storage.batch {
+		for _, pattern := range patterns {
+			if requested[pattern] {
+				t.Fatalf("pattern %s is requested twice", pattern)
+			}
+			requested[pattern] = true
+		}
+	}
+
+	for i, ua := range uas {
+		expected, err := bc.GetBrowser(ua)
+		assert.Equal(t, errs[i], err)
+		assert.Equal(t, browsers[i], expected)
+	}
+}
+
+func TestGetCandidates(t *testing.T) {
+	bc, err := compileAndLoad("fixtures/lite_php_browscap.ini")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ua := testUserAgent
+
+	all, err := bc.GetCandidates(ua, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(all) < 2 {
+		t.Fatalf("expected several candidates, got %d", len(all))
+	}
+
+	b, err := bc.GetBrowser(ua)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, all[0].Browser, b)
+
+	for _, m := range all {
+		assert.Equal(t, m.Browser.Pattern, m.Pattern)
+	}
+
+	limited, err := bc.GetCandidates(ua, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, limited, all[:2])
+}
+
+func TestCompileReader(t *testing.T) {
+	data, err := os.ReadFile("fixtures/lite_php_browscap.ini")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loader := NewLoader(NewMemoryBrowserStorage())
+	err = loader.CompileReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bc, err := loader.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := bc.GetBrowser(testUserAgent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, b.Browser, "Chrome")
+}
@@ -0,0 +1,243 @@
+package browscap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"golang.org/x/sync/singleflight"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// BrowserGetter resolves user agents. It is implemented by Browscap, Reloader and CachedBrowscap.
+type BrowserGetter interface {
+	GetBrowserContext(ctx context.Context, ua string) (*Browser, error)
+}
+
+type CachedBrowscapOption func(*CachedBrowscap)
+
+// WithCacheTTL sets how long a result stays cached, results never expire by default. Expired results are dropped
+// when they are looked up again or pushed out by newer ones.
+func WithCacheTTL(ttl time.Duration) CachedBrowscapOption {
+	return func(c *CachedBrowscap) {
+		c.ttl = ttl
+	}
+}
+
+// WithCacheMaxBytes bounds the estimated memory used by the cached results, on top of the number of results.
+func WithCacheMaxBytes(maxBytes int64) CachedBrowscapOption {
+	return func(c *CachedBrowscap) {
+		c.maxBytes = maxBytes
+	}
+}
+
+// CacheStats is a snapshot of the CachedBrowscap counters.
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	// Len is the number of cached results and Bytes their estimated size
+	Len   int
+	Bytes int64
+}
+
+type cachedResult struct {
+	browser *Browser
+	err     error
+	size    int64
+	expires time.Time
+}
+
+// CachedBrowscap caches the results of a BrowserGetter by user agent. Concurrent misses of the same user agent are
+// resolved only once. Results are cached until they are evicted, so the cache has to be purged when the wrapped
+// getter starts serving a new version, e.g. from the Reloader WithOnReload callback.
+type CachedBrowscap struct {
+	getter   BrowserGetter
+	cache    *lru.Cache[string, *cachedResult]
+	group    singleflight.Group
+	ttl      time.Duration
+	maxBytes int64
+	// mu serializes adding results, so that the size accounting stays exact
+	mu        sync.Mutex
+	purging   atomic.Bool
+	bytes     atomic.Int64
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+func NewCachedBrowscap(getter BrowserGetter, cacheSize int, opts ...CachedBrowscapOption) (*CachedBrowscap, error) {
+	if cacheSize <= 0 {
+		return nil, fmt.Errorf("invalid cache size %d", cacheSize)
+	}
+
+	c := &CachedBrowscap{
+		getter: getter,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	cache, err := lru.NewWithEvict[string, *cachedResult](cacheSize, c.onEvict)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create cache. %w", err)
+	}
+	c.cache = cache
+
+	return c, nil
+}
+
+func (c *CachedBrowscap) onEvict(_ string, res *cachedResult) {
+	c.bytes.Add(-res.size)
+	if !c.purging.Load() {
+		c.evictions.Add(1)
+	}
+}
+
+func (c *CachedBrowscap) GetBrowser(ua string) (*Browser, error) {
+	return c.GetBrowserContext(context.Background(), ua)
+}
+
+// GetBrowserContext returns a copy of the cached result, so callers may modify it.
+func (c *CachedBrowscap) GetBrowserContext(ctx context.Context, ua string) (*Browser, error) {
+	if res, ok := c.get(ua); ok {
+		c.hits.Add(1)
+		return res.copy()
+	}
+
+	c.misses.Add(1)
+
+	// the lookup is shared by every caller waiting for ua, so it must not be canceled by one of them leaving
+	ch := c.group.DoChan(ua, func() (any, error) {
+		return c.resolve(context.WithoutCancel(ctx), ua)
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-ch:
+		if r.Err != nil {
+			return nil, r.Err
+		}
+
+		return r.Val.(*cachedResult).copy()
+	}
+}
+
+func (c *CachedBrowscap) resolve(ctx context.Context, ua string) (*cachedResult, error) {
+	browser, err := c.getter.GetBrowserContext(ctx, ua)
+
+	res := &cachedResult{
+		browser: browser,
+		err:     err,
+	}
+
+	// only results that don't depend on the state of the storage are cached
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		var warning *ResolutionWarning
+		if !errors.As(err, &warning) {
+			return nil, err
+		}
+	}
+
+	res.size = resultSize(ua, browser)
+	if c.ttl > 0 {
+		res.expires = time.Now().Add(c.ttl)
+	}
+	c.add(ua, res)
+
+	return res, nil
+}
+
+// get returns the cached result of ua unless it has expired.
+func (c *CachedBrowscap) get(ua string) (*cachedResult, bool) {
+	res, ok := c.cache.Get(ua)
+	if !ok || !res.expired() {
+		return res, ok
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// the result may have been replaced in the meantime
+	if res, ok = c.cache.Peek(ua); ok && res.expired() {
+		c.cache.Remove(ua)
+	}
+
+	return nil, false
+}
+
+func (c *CachedBrowscap) add(ua string, res *cachedResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if old, ok := c.cache.Peek(ua); ok {
+		c.bytes.Add(-old.size)
+	}
+
+	c.cache.Add(ua, res)
+	c.bytes.Add(res.size)
+
+	for c.maxBytes > 0 && c.bytes.Load() > c.maxBytes {
+		_, _, ok := c.cache.RemoveOldest()
+		if !ok {
+			break
+		}
+	}
+}
+
+// resultSize estimates the memory a cached result takes.
+func resultSize(ua string, browser *Browser) int64 {
+	size := int64(len(ua)) + int64(unsafe.Sizeof(cachedResult{}))
+	if browser == nil {
+		return size
+	}
+
+	size += int64(unsafe.Sizeof(*browser))
+	for _, f := range browser.Fields() {
+		if s, ok := f.Value.(string); ok {
+			size += int64(len(s))
+		}
+	}
+
+	return size
+}
+
+func (r *cachedResult) expired() bool {
+	return !r.expires.IsZero() && time.Now().After(r.expires)
+}
+
+func (r *cachedResult) copy() (*Browser, error) {
+	if r.browser == nil {
+		return nil, r.err
+	}
+
+	b := *r.browser
+
+	return &b, r.err
+}
+
+// Purge removes all cached results.
+func (c *CachedBrowscap) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.purging.Store(true)
+	c.cache.Purge()
+	c.purging.Store(false)
+}
+
+// Stats returns a snapshot of the cache counters.
+func (c *CachedBrowscap) Stats() CacheStats {
+	return CacheStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Len:       c.cache.Len(),
+		Bytes:     c.bytes.Load(),
+	}
+}
@@ -0,0 +1,154 @@
+package browscap_test
+
+import (
+	"errors"
+	"github.com/eugeniypetrov/browscap-go/browscap"
+	"github.com/eugeniypetrov/browscap-go/browscap/internal/browscaptest"
+	"github.com/magiconair/properties/assert"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCachedBrowscap(t *testing.T) {
+	getter := &browscaptest.CountingGetter{}
+	c, err := browscap.NewCachedBrowscap(getter, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := c.GetBrowser("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Browser = "modified"
+
+	b, err = c.GetBrowser("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, b.Browser, "a")
+
+	_, err = c.GetBrowser("")
+	if !errors.Is(err, browscap.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	_, err = c.GetBrowser("")
+	if !errors.Is(err, browscap.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	// storage errors are not cached
+	for i := 0; i < 2; i++ {
+		_, err = c.GetBrowser("failing")
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	assert.Equal(t, getter.Calls.Load(), int32(4))
+
+	stats := c.Stats()
+	assert.Equal(t, stats.Hits, uint64(2))
+	assert.Equal(t, stats.Misses, uint64(4))
+	assert.Equal(t, stats.Evictions, uint64(0))
+	assert.Equal(t, stats.Len, 2)
+
+	_, err = c.GetBrowser("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, c.Stats().Evictions, uint64(1))
+
+	c.Purge()
+	stats = c.Stats()
+	assert.Equal(t, stats.Len, 0)
+	assert.Equal(t, stats.Bytes, int64(0))
+	assert.Equal(t, stats.Evictions, uint64(1))
+}
+
+func TestCachedBrowscapSingleflight(t *testing.T) {
+	getter := &browscaptest.CountingGetter{Release: make(chan struct{})}
+	c, err := browscap.NewCachedBrowscap(getter, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			b, err := c.GetBrowser("a")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			assert.Equal(t, b.Browser, "a")
+		}()
+	}
+
+	// let the goroutines pile up on the first lookup
+	for c.Stats().Misses < 10 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(getter.Release)
+	wg.Wait()
+
+	assert.Equal(t, getter.Calls.Load(), int32(1))
+}
+
+func TestCachedBrowscapLimits(t *testing.T) {
+	getter := &browscaptest.CountingGetter{}
+	c, err := browscap.NewCachedBrowscap(getter, 100, browscap.WithCacheMaxBytes(1), browscap.WithCacheTTL(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ua := range []string{"a", "b", "c"} {
+		_, err = c.GetBrowser(ua)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// every result exceeds the memory bound on its own
+	stats := c.Stats()
+	assert.Equal(t, stats.Len, 0)
+	assert.Equal(t, stats.Bytes, int64(0))
+	assert.Equal(t, stats.Evictions, uint64(3))
+
+	c, err = browscap.NewCachedBrowscap(getter, 100, browscap.WithCacheTTL(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.GetBrowser("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	_, err = c.GetBrowser("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats = c.Stats()
+	assert.Equal(t, stats.Hits, uint64(0))
+	assert.Equal(t, stats.Len, 1)
+	assert.Equal(t, stats.Evictions, uint64(1))
+
+	// expiring results must not leave anything running behind the cache
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		_, err = browscap.NewCachedBrowscap(getter, 100, browscap.WithCacheTTL(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Equal(t, runtime.NumGoroutine(), before)
+}
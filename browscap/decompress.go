@@ -0,0 +1,146 @@
+package browscap
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	zipMagic   = []byte("PK\x03\x04")
+)
+
+const (
+	zipLocalHeaderLen     = 30
+	zipMethodStore        = 0
+	zipMethodDeflate      = 8
+	zipFlagDataDescriptor = 0x8
+)
+
+var zipDataDescriptorMagic = []byte("PK\x07\x08")
+
+// decompress detects gzip, bzip2 and zip input by its magic bytes and returns a reader of the decompressed data.
+// Any other input is returned as is.
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+
+	magic, err := br.Peek(len(zipMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("error reading magic bytes: %w", err)
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("error opening gzip stream: %w", err)
+		}
+		return gr, nil
+	case bytes.HasPrefix(magic, bzip2Magic):
+		return bzip2.NewReader(br), nil
+	case bytes.HasPrefix(magic, zipMagic):
+		zr, err := newZipEntryReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("error opening zip archive: %w", err)
+		}
+		return zr, nil
+	default:
+		return br, nil
+	}
+}
+
+// zipEntryReader streams the only entry of a zip archive without the need of random access to the archive, so it
+// works for any io.Reader. Once the entry is read it makes sure no other entry follows.
+type zipEntryReader struct {
+	br    *bufio.Reader
+	r     io.Reader
+	flags uint16
+	done  bool
+}
+
+func newZipEntryReader(br *bufio.Reader) (*zipEntryReader, error) {
+	header := make([]byte, zipLocalHeaderLen)
+	_, err := io.ReadFull(br, header)
+	if err != nil {
+		return nil, fmt.Errorf("error reading local file header: %w", err)
+	}
+
+	le := binary.LittleEndian
+	flags := le.Uint16(header[6:])
+	method := le.Uint16(header[8:])
+	compressedSize := le.Uint32(header[18:])
+	nameLen := le.Uint16(header[26:])
+	extraLen := le.Uint16(header[28:])
+
+	_, err = br.Discard(int(nameLen) + int(extraLen))
+	if err != nil {
+		return nil, fmt.Errorf("error skipping file name: %w", err)
+	}
+
+	zr := &zipEntryReader{
+		br:    br,
+		flags: flags,
+	}
+
+	switch method {
+	case zipMethodDeflate:
+		zr.r = flate.NewReader(br)
+	case zipMethodStore:
+		if flags&zipFlagDataDescriptor != 0 {
+			return nil, fmt.Errorf("stored entry of unknown size is not supported")
+		}
+		zr.r = io.LimitReader(br, int64(compressedSize))
+	default:
+		return nil, fmt.Errorf("unsupported compression method %d", method)
+	}
+
+	return zr, nil
+}
+
+func (z *zipEntryReader) Read(p []byte) (int, error) {
+	if z.done {
+		return 0, io.EOF
+	}
+
+	n, err := z.r.Read(p)
+	if errors.Is(err, io.EOF) {
+		z.done = true
+
+		err = z.checkSingleEntry()
+		if err == nil {
+			err = io.EOF
+		}
+	}
+
+	return n, err
+}
+
+func (z *zipEntryReader) checkSingleEntry() error {
+	if z.flags&zipFlagDataDescriptor != 0 {
+		// crc-32, compressed and uncompressed sizes, optionally preceded by a signature
+		size := 12
+		if sig, _ := z.br.Peek(len(zipDataDescriptorMagic)); bytes.Equal(sig, zipDataDescriptorMagic) {
+			size += len(zipDataDescriptorMagic)
+		}
+
+		_, err := z.br.Discard(size)
+		if err != nil {
+			return fmt.Errorf("error skipping data descriptor: %w", err)
+		}
+	}
+
+	next, _ := z.br.Peek(len(zipMagic))
+	if bytes.Equal(next, zipMagic) {
+		return fmt.Errorf("zip archive must contain a single file")
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package browscap
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"github.com/magiconair/properties/assert"
+	"io"
+	"os"
+	"testing"
+)
+
+func compileReaderAndCheck(t *testing.T, r io.Reader) {
+	loader := NewLoader(NewMemoryBrowserStorage())
+	err := loader.CompileReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bc, err := loader.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := bc.GetBrowser(testUserAgent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, b.Browser, "Chrome")
+}
+
+func zipArchive(t *testing.T, data []byte, names ...string) []byte {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for _, name := range names {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = w.Write(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := zw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestCompileCompressed(t *testing.T) {
+	data, err := os.ReadFile("fixtures/lite_php_browscap.ini")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("gzip", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		gw := gzip.NewWriter(buf)
+		_, err := gw.Write(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = gw.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		compileReaderAndCheck(t, buf)
+	})
+
+	t.Run("bzip2", func(t *testing.T) {
+		f, err := os.Open("fixtures/lite_php_browscap.ini.bz2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		compileReaderAndCheck(t, f)
+	})
+
+	t.Run("zip", func(t *testing.T) {
+		compileReaderAndCheck(t, bytes.NewReader(zipArchive(t, data, "lite_php_browscap.ini")))
+	})
+
+	t.Run("zip with several files", func(t *testing.T) {
+		archive := zipArchive(t, data, "lite_php_browscap.ini", "copy.ini")
+
+		err := NewLoader(NewMemoryBrowserStorage()).CompileReader(bytes.NewReader(archive))
+		if err == nil {
+			t.Fatal("expected error for multi-file archive")
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package browscap
+
+import (
+	"context"
+	"strings"
+)
+
+// Candidate is a pattern matching a user agent together with the score used to rank it.
+type Candidate struct {
+	Pattern string
+	// Score is the number of non-wildcard characters of the pattern, the more the better
+	Score int
+}
+
+// ChainLink is a single step of the inheritance chain of the matched pattern.
+type ChainLink struct {
+	Pattern string
+	// Fields lists the Browser fields whose values were supplied by this pattern
+	Fields []string
+}
+
+// Explanation describes how a user agent was resolved into a Browser.
+type Explanation struct {
+	UserAgent string
+	// Candidates holds every matching pattern, best first
+	Candidates []Candidate
+	// Pattern is the winning pattern
+	Pattern string
+	// Chain goes from the winning pattern up to defaultproperties. Records compiled WithFlatten keep no inheritance,
+	// the chain then holds the winning pattern alone, supplying every field set anywhere along the real one.
+	Chain []ChainLink
+	// DefaultFields lists the Browser fields that fell back to DefaultBrowser
+	DefaultFields []string
+	Browser       *Browser
+}
+
+// Explain resolves ua the same way GetBrowser does and reports every matching candidate, the winning pattern and
+// which ancestor supplied each field of the result. Browscaps loaded from a storage compiled WithFlatten cannot tell
+// the ancestors apart, see Explanation.Chain.
+func (b *Browscap) Explain(ua string) (*Explanation, error) {
+	return b.ExplainContext(context.Background(), ua)
+}
+
+func (b *Browscap) ExplainContext(ctx context.Context, ua string) (*Explanation, error) {
+	res := &Explanation{
+		UserAgent: ua,
+	}
+
+	patterns := b.rankedPatterns(strings.ToLower(ua))
+
+	for _, p := range patterns {
+		res.Candidates = append(res.Candidates, Candidate{
+			Pattern: p,
+			Score:   patternLen(p),
+		})
+	}
+
+	if len(patterns) == 0 {
+		return res, ErrNotFound
+	}
+
+	// every node read while resolving, the chain of the winner is among them
+	read := make(map[string]*BrowserNode)
+	storageGet := b.storageGetter(ctx)
+	get := func(pattern string) (*BrowserNode, error) {
+		node, err := storageGet(pattern)
+		if err == nil {
+			read[pattern] = node
+		}
+
+		return node, err
+	}
+
+	browser, err := b.resolve(patterns, get)
+	if browser == nil {
+		return res, err
+	}
+
+	res.Pattern = browser.Pattern
+	res.Browser = browser
+
+	// under ResolveDefault no pattern wins and every field falls back to DefaultBrowser
+	node := &BrowserNode{}
+	pattern := res.Pattern
+	for pattern != "" {
+		link := read[pattern]
+
+		res.Chain = append(res.Chain, ChainLink{
+			Pattern: pattern,
+			Fields:  suppliedFields(link, node),
+		})
+		mergeBrowsers(link, node)
+
+		if pattern == DefaultPatternName || isFlattened(link) {
+			break
+		}
+
+		pattern = link.Parent
+	}
+
+	res.DefaultFields = suppliedFields(DefaultBrowser, node)
+
+	return res, err
+}
@@ -0,0 +1,127 @@
+package browscap
+
+import (
+	"errors"
+	"github.com/magiconair/properties/assert"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	bc, err := compileAndLoad("fixtures/lite_php_browscap.ini")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ua := testUserAgent
+
+	e, err := bc.Explain(ua)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := bc.GetBrowser(ua)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, e.Browser, b)
+	assert.Equal(t, e.Pattern, b.Pattern)
+	assert.Equal(t, e.Candidates[0].Pattern, e.Pattern)
+	assert.Equal(t, e.Candidates[0].Score, patternLen(e.Pattern))
+
+	for i := 1; i < len(e.Candidates); i++ {
+		if e.Candidates[i].Score > e.Candidates[i-1].Score {
+			t.Fatalf("candidates are not ranked: %v", e.Candidates)
+		}
+	}
+
+	assert.Equal(t, e.Chain[0].Pattern, e.Pattern)
+	assert.Equal(t, e.Chain[1].Pattern, "chrome 128.0")
+	assert.Equal(t, e.Chain[len(e.Chain)-1].Pattern, DefaultPatternName)
+
+	sources := map[string]string{}
+	for _, link := range e.Chain {
+		for _, field := range link.Fields {
+			if _, ok := sources[field]; ok {
+				t.Fatalf("field %s is supplied twice", field)
+			}
+			sources[field] = link.Pattern
+		}
+	}
+
+	assert.Equal(t, sources["Browser"], "chrome 128.0")
+	assert.Equal(t, sources["Platform"], e.Pattern)
+}
+
+func TestExplainFlattened(t *testing.T) {
+	loader := NewLoader(NewMemoryBrowserStorage(), WithFlatten(true))
+
+	err := loader.Compile("fixtures/lite_php_browscap.ini")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bc, err := loader.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := bc.Explain(testUserAgent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := compileAndLoad("fixtures/lite_php_browscap.ini")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := expected.GetBrowser(testUserAgent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, e.Browser, b)
+
+	// the parents have been merged into the record, it supplies the fields of the whole chain
+	assert.Equal(t, len(e.Chain), 1)
+	assert.Equal(t, e.Chain[0].Pattern, e.Pattern)
+
+	fields := map[string]bool{}
+	for _, field := range e.Chain[0].Fields {
+		fields[field] = true
+	}
+
+	assert.Equal(t, fields["Browser"], true)
+	assert.Equal(t, fields["Platform"], true)
+}
+
+func TestExplainResolutionPolicy(t *testing.T) {
+	for _, policy := range []ResolutionPolicy{ResolveStrict, ResolveNextCandidate, ResolveDefault} {
+		bc := newBrokenChainBrowscap(t, WithResolutionPolicy(policy))
+
+		e, err := bc.Explain("Chrome")
+		b, expectedErr := bc.GetBrowser("Chrome")
+
+		assert.Equal(t, errors.Is(err, ErrBrokenParentChain), errors.Is(expectedErr, ErrBrokenParentChain))
+		assert.Equal(t, len(e.Candidates), 2)
+
+		if policy == ResolveStrict {
+			continue
+		}
+
+		assert.Equal(t, e.Browser, b)
+		assert.Equal(t, e.Pattern, b.Pattern)
+	}
+
+	bc := newBrokenChainBrowscap(t, WithResolutionPolicy(ResolveNextCandidate))
+
+	e, err := bc.Explain("Chrome")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, e.Pattern, "*")
+	assert.Equal(t, len(e.Chain), 2)
+	assert.Equal(t, e.Chain[0].Fields, []string{"Pattern", "Browser"})
+}
@@ -0,0 +1,694 @@
+package browscap
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/zeebo/xxh3"
+	"io/fs"
+	"iter"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// The storage file layout is
+//
+//	header: magic "BCFS", format (uint32), version (int64), index offset (uint64), bucket count (uint64)
+//	records: uvarint length + record, each starting with the pattern
+//	index: bucket count (hash uint64, record offset uint64) pairs, open addressing with linear probing
+//	type: uvarint length + bytes
+//
+// All integers are little endian. An empty bucket has the offset 0, which never points to a record.
+var fileStorageMagic = []byte("BCFS")
+
+const (
+	fileStorageFormat     = 1
+	fileStorageHeaderSize = 32
+	fileStorageBucketSize = 16
+)
+
+var errCorruptedFile = errors.New("corrupted storage file")
+
+// FileBrowserStorage keeps browsers in a single read-only file that is memory mapped where the platform supports it,
+// so no database is needed and the page cache is shared between processes using the same file.
+//
+// A compile is written into a temporary file next to the target one, which replaces the target once the version is
+// saved. Readers in other processes pick the new file up on the next GetVersion or Patterns call.
+type FileBrowserStorage struct {
+	path string
+
+	// mu guards the mapping, readers hold it while decoding records
+	mu   sync.RWMutex
+	data []byte
+	info os.FileInfo
+
+	// compile state
+	tmp     *os.File
+	w       *bufio.Writer
+	offset  uint64
+	entries []fileStorageEntry
+	saved   map[string]struct{}
+}
+
+type fileStorageEntry struct {
+	hash   uint64
+	offset uint64
+}
+
+func NewFileBrowserStorage(path string) *FileBrowserStorage {
+	return &FileBrowserStorage{
+		path: path,
+	}
+}
+
+func (s *FileBrowserStorage) hash(pattern string) uint64 {
+	return xxh3.Hash([]byte(pattern))
+}
+
+// refresh maps the file if it has been replaced since it was mapped last.
+func (s *FileBrowserStorage) refresh() error {
+	info, err := os.Stat(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error checking %s: %w", s.path, err)
+	}
+
+	s.mu.RLock()
+	same := s.info != nil && os.SameFile(s.info, info)
+	s.mu.RUnlock()
+
+	if same {
+		return nil
+	}
+
+	return s.open()
+}
+
+// mapped maps the file on first use, so that a storage opened on an existing file serves
+// lookups right away. Replacements of the file are picked up by GetVersion and Patterns.
+func (s *FileBrowserStorage) mapped() error {
+	s.mu.RLock()
+	ok := s.data != nil
+	s.mu.RUnlock()
+
+	if ok {
+		return nil
+	}
+
+	return s.refresh()
+}
+
+func (s *FileBrowserStorage) open() error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", s.path, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("error checking %s: %w", s.path, err)
+	}
+
+	data, err := mapFile(f, info.Size())
+	if err != nil {
+		return fmt.Errorf("error mapping %s: %w", s.path, err)
+	}
+
+	err = checkFileStorage(data)
+	if err != nil {
+		_ = unmapFile(data)
+		return fmt.Errorf("error reading %s: %w", s.path, err)
+	}
+
+	s.mu.Lock()
+	old := s.data
+	s.data = data
+	s.info = info
+	s.mu.Unlock()
+
+	if old != nil {
+		return unmapFile(old)
+	}
+
+	return nil
+}
+
+func checkFileStorage(data []byte) error {
+	if len(data) < fileStorageHeaderSize || string(data[:len(fileStorageMagic)]) != string(fileStorageMagic) {
+		return fmt.Errorf("not a browscap storage file")
+	}
+
+	if format := binary.LittleEndian.Uint32(data[4:]); format != fileStorageFormat {
+		return fmt.Errorf("unsupported storage format %d", format)
+	}
+
+	indexOffset := binary.LittleEndian.Uint64(data[16:])
+	buckets := binary.LittleEndian.Uint64(data[24:])
+	if indexOffset < fileStorageHeaderSize || buckets == 0 || buckets&(buckets-1) != 0 ||
+		indexOffset+buckets*fileStorageBucketSize > uint64(len(data)) {
+		return errCorruptedFile
+	}
+
+	return nil
+}
+
+func (s *FileBrowserStorage) indexOffset() uint64 {
+	return binary.LittleEndian.Uint64(s.data[16:])
+}
+
+func (s *FileBrowserStorage) buckets() uint64 {
+	return binary.LittleEndian.Uint64(s.data[24:])
+}
+
+// Close unmaps the file. A compile in progress is discarded.
+func (s *FileBrowserStorage) Close() error {
+	err := s.Rollback()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.data != nil {
+		err = errors.Join(err, unmapFile(s.data))
+		s.data = nil
+		s.info = nil
+	}
+
+	return err
+}
+
+func (s *FileBrowserStorage) Prepare() error {
+	return s.PrepareContext(context.Background())
+}
+
+func (s *FileBrowserStorage) PrepareContext(ctx context.Context) error {
+	err := s.RollbackContext(ctx)
+	if err != nil {
+		return fmt.Errorf("error discarding previous compile: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file: %w", err)
+	}
+
+	// the file is meant to be shared with other processes
+	err = tmp.Chmod(0o644)
+	if err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("error creating temporary file: %w", err)
+	}
+
+	s.tmp = tmp
+	s.w = bufio.NewWriter(tmp)
+	s.entries = nil
+	s.saved = make(map[string]struct{})
+
+	// the header is written once the version is known
+	_, err = s.w.Write(make([]byte, fileStorageHeaderSize))
+	if err != nil {
+		return fmt.Errorf("error writing header: %w", err)
+	}
+	s.offset = fileStorageHeaderSize
+
+	return nil
+}
+
+func (s *FileBrowserStorage) GetVersion() (*Version, error) {
+	return s.GetVersionContext(context.Background())
+}
+
+func (s *FileBrowserStorage) GetVersionContext(_ context.Context) (*Version, error) {
+	err := s.refresh()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.data == nil {
+		return nil, ErrEmptyCache
+	}
+
+	d := &fileStorageDecoder{
+		data: s.data,
+		pos:  s.indexOffset() + s.buckets()*fileStorageBucketSize,
+	}
+	typ := d.string()
+	if d.err != nil {
+		return nil, fmt.Errorf("error reading type: %w", d.err)
+	}
+
+	return &Version{
+		Version: int(int64(binary.LittleEndian.Uint64(s.data[8:]))),
+		Type:    typ,
+	}, nil
+}
+
+func (s *FileBrowserStorage) SaveVersion(ver *Version) error {
+	return s.SaveVersionContext(context.Background(), ver)
+}
+
+func (s *FileBrowserStorage) SaveVersionContext(_ context.Context, ver *Version) error {
+	if s.tmp == nil {
+		return fmt.Errorf("storage is not prepared")
+	}
+
+	buckets := uint64(1)
+	for buckets < uint64(len(s.entries))*2 {
+		buckets <<= 1
+	}
+
+	index := make([]byte, buckets*fileStorageBucketSize)
+	for _, e := range s.entries {
+		i := e.hash & (buckets - 1)
+		for binary.LittleEndian.Uint64(index[i*fileStorageBucketSize+8:]) != 0 {
+			i = (i + 1) & (buckets - 1)
+		}
+
+		binary.LittleEndian.PutUint64(index[i*fileStorageBucketSize:], e.hash)
+		binary.LittleEndian.PutUint64(index[i*fileStorageBucketSize+8:], e.offset)
+	}
+
+	indexOffset := s.offset
+
+	_, err := s.w.Write(index)
+	if err != nil {
+		return fmt.Errorf("error writing index: %w", err)
+	}
+
+	_, err = s.w.Write(binary.AppendUvarint(nil, uint64(len(ver.Type))))
+	if err == nil {
+		_, err = s.w.WriteString(ver.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing type: %w", err)
+	}
+
+	err = s.w.Flush()
+	if err != nil {
+		return fmt.Errorf("error writing %s: %w", s.tmp.Name(), err)
+	}
+
+	header := make([]byte, 0, fileStorageHeaderSize)
+	header = append(header, fileStorageMagic...)
+	header = binary.LittleEndian.AppendUint32(header, fileStorageFormat)
+	header = binary.LittleEndian.AppendUint64(header, uint64(int64(ver.Version)))
+	header = binary.LittleEndian.AppendUint64(header, indexOffset)
+	header = binary.LittleEndian.AppendUint64(header, buckets)
+
+	_, err = s.tmp.WriteAt(header, 0)
+	if err != nil {
+		return fmt.Errorf("error writing header: %w", err)
+	}
+
+	err = s.tmp.Sync()
+	if err != nil {
+		return fmt.Errorf("error syncing %s: %w", s.tmp.Name(), err)
+	}
+
+	err = s.tmp.Close()
+	if err != nil {
+		return fmt.Errorf("error closing %s: %w", s.tmp.Name(), err)
+	}
+
+	err = os.Rename(s.tmp.Name(), s.path)
+	if err != nil {
+		return fmt.Errorf("error replacing %s: %w", s.path, err)
+	}
+
+	s.tmp = nil
+	s.w = nil
+	s.entries = nil
+	s.saved = nil
+
+	return s.open()
+}
+
+func (s *FileBrowserStorage) Save(node *BrowserNode) error {
+	return s.SaveContext(context.Background(), node)
+}
+
+func (s *FileBrowserStorage) SaveContext(_ context.Context, node *BrowserNode) error {
+	if s.tmp == nil {
+		return fmt.Errorf("storage is not prepared")
+	}
+
+	// the first node of a pattern wins, like it does for the database storages
+	if _, ok := s.saved[node.Pattern]; ok {
+		return nil
+	}
+	s.saved[node.Pattern] = struct{}{}
+
+	record := encodeBrowserNode(node)
+	record = append(binary.AppendUvarint(nil, uint64(len(record))), record...)
+
+	_, err := s.w.Write(record)
+	if err != nil {
+		return fmt.Errorf("error writing %s: %w", node.Pattern, err)
+	}
+
+	s.entries = append(s.entries, fileStorageEntry{
+		hash:   s.hash(node.Pattern),
+		offset: s.offset,
+	})
+	s.offset += uint64(len(record))
+
+	return nil
+}
+
+func (s *FileBrowserStorage) Get(pattern string) (*BrowserNode, error) {
+	return s.GetContext(context.Background(), pattern)
+}
+
+func (s *FileBrowserStorage) GetContext(_ context.Context, pattern string) (*BrowserNode, error) {
+	err := s.mapped()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.get(pattern)
+}
+
+func (s *FileBrowserStorage) get(pattern string) (*BrowserNode, error) {
+	if s.data == nil {
+		return nil, ErrPatternNotFound
+	}
+
+	hash := s.hash(pattern)
+	buckets := s.buckets()
+	index := s.data[s.indexOffset():]
+
+	for i, n := hash&(buckets-1), uint64(0); n < buckets; i, n = (i+1)&(buckets-1), n+1 {
+		offset := binary.LittleEndian.Uint64(index[i*fileStorageBucketSize+8:])
+		if offset == 0 {
+			break
+		}
+
+		if binary.LittleEndian.Uint64(index[i*fileStorageBucketSize:]) != hash {
+			continue
+		}
+
+		node, err := s.decode(offset)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding %s: %w", pattern, err)
+		}
+
+		if node.Pattern == pattern {
+			return node, nil
+		}
+	}
+
+	return nil, ErrPatternNotFound
+}
+
+func (s *FileBrowserStorage) decode(offset uint64) (*BrowserNode, error) {
+	d := &fileStorageDecoder{
+		data: s.data[:s.indexOffset()],
+		pos:  offset,
+	}
+
+	record := d.bytes()
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	return decodeBrowserNode(record)
+}
+
+func (s *FileBrowserStorage) GetMany(patterns []string) (map[string]*BrowserNode, error) {
+	return s.GetManyContext(context.Background(), patterns)
+}
+
+func (s *FileBrowserStorage) GetManyContext(_ context.Context, patterns []string) (map[string]*BrowserNode, error) {
+	err := s.mapped()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	res := make(map[string]*BrowserNode, len(patterns))
+	for _, pattern := range patterns {
+		node, err := s.get(pattern)
+		if errors.Is(err, ErrPatternNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		res[pattern] = node
+	}
+
+	return res, nil
+}
+
+func (s *FileBrowserStorage) Patterns() iter.Seq2[string, error] {
+	return s.PatternsContext(context.Background())
+}
+
+func (s *FileBrowserStorage) PatternsContext(ctx context.Context) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		err := s.refresh()
+		if err != nil {
+			yield("", err)
+			return
+		}
+
+		patterns, err := s.patterns()
+		if err != nil {
+			yield("", err)
+			return
+		}
+
+		for _, pattern := range patterns {
+			if err := ctx.Err(); err != nil {
+				yield("", err)
+				return
+			}
+
+			if !yield(pattern, nil) {
+				return
+			}
+		}
+	}
+}
+
+// patterns copies the patterns out of the mapping, so that the consumer may use the
+// storage, or finish a compile, while iterating.
+func (s *FileBrowserStorage) patterns() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.data == nil {
+		return nil, nil
+	}
+
+	d := &fileStorageDecoder{
+		data: s.data[:s.indexOffset()],
+		pos:  fileStorageHeaderSize,
+	}
+
+	var patterns []string
+	for d.pos < uint64(len(d.data)) {
+		record := &fileStorageDecoder{data: d.bytes()}
+		pattern := record.string()
+		if err := errors.Join(d.err, record.err); err != nil {
+			return nil, fmt.Errorf("error reading pattern at %d: %w", d.pos, err)
+		}
+
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns, nil
+}
+
+func (s *FileBrowserStorage) Rollback() error {
+	return s.RollbackContext(context.Background())
+}
+
+func (s *FileBrowserStorage) RollbackContext(_ context.Context) error {
+	if s.tmp == nil {
+		return nil
+	}
+
+	name := s.tmp.Name()
+	err := errors.Join(s.tmp.Close(), os.Remove(name))
+
+	s.tmp = nil
+	s.w = nil
+	s.entries = nil
+	s.saved = nil
+
+	if err != nil {
+		return fmt.Errorf("error removing %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// nodeEncoder appends the fields of a BrowserNode to buf, see encodeBrowserNode. Pointer fields are prefixed with
+// a byte telling whether they are set.
+type nodeEncoder struct {
+	buf []byte
+}
+
+func (e *nodeEncoder) set(ok bool) bool {
+	e.bool(ok)
+	return ok
+}
+
+func (e *nodeEncoder) string(v string) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+func (e *nodeEncoder) int(v int) {
+	e.buf = binary.AppendVarint(e.buf, int64(v))
+}
+
+func (e *nodeEncoder) bool(v bool) {
+	if v {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *nodeEncoder) stringPtr(v *string) {
+	if e.set(v != nil) {
+		e.string(*v)
+	}
+}
+
+func (e *nodeEncoder) intPtr(v *int) {
+	if e.set(v != nil) {
+		e.int(*v)
+	}
+}
+
+func (e *nodeEncoder) boolPtr(v *bool) {
+	if e.set(v != nil) {
+		e.bool(*v)
+	}
+}
+
+// fileStorageDecoder reads from the mapped file without ever going past its end, the first error sticks.
+type fileStorageDecoder struct {
+	data []byte
+	pos  uint64
+	err  error
+}
+
+func (d *fileStorageDecoder) fail() {
+	if d.err == nil {
+		d.err = errCorruptedFile
+	}
+	d.pos = uint64(len(d.data))
+}
+
+func (d *fileStorageDecoder) byte() byte {
+	if d.err != nil || d.pos >= uint64(len(d.data)) {
+		d.fail()
+		return 0
+	}
+
+	c := d.data[d.pos]
+	d.pos++
+
+	return c
+}
+
+func (d *fileStorageDecoder) uvarint() uint64 {
+	if d.err != nil || d.pos >= uint64(len(d.data)) {
+		d.fail()
+		return 0
+	}
+
+	v, n := binary.Uvarint(d.data[d.pos:])
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.pos += uint64(n)
+
+	return v
+}
+
+func (d *fileStorageDecoder) varint() int64 {
+	if d.err != nil || d.pos >= uint64(len(d.data)) {
+		d.fail()
+		return 0
+	}
+
+	v, n := binary.Varint(d.data[d.pos:])
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.pos += uint64(n)
+
+	return v
+}
+
+func (d *fileStorageDecoder) bytes() []byte {
+	l := d.uvarint()
+	if d.err != nil || l > uint64(len(d.data))-d.pos {
+		d.fail()
+		return nil
+	}
+
+	p := d.data[d.pos : d.pos+l]
+	d.pos += l
+
+	return p
+}
+
+// string copies the bytes, so that the result outlives the mapping.
+func (d *fileStorageDecoder) string() string {
+	return string(d.bytes())
+}
+
+func (d *fileStorageDecoder) int() int {
+	return int(d.varint())
+}
+
+func (d *fileStorageDecoder) bool() bool {
+	return d.byte() != 0
+}
+
+func (d *fileStorageDecoder) stringPtr() *string {
+	if !d.bool() {
+		return nil
+	}
+
+	return StringPtr(d.string())
+}
+
+func (d *fileStorageDecoder) intPtr() *int {
+	if !d.bool() {
+		return nil
+	}
+
+	return IntPtr(d.int())
+}
+
+func (d *fileStorageDecoder) boolPtr() *bool {
+	if !d.bool() {
+		return nil
+	}
+
+	return BoolPtr(d.bool())
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package browscap
+
+import (
+	"os"
+	"syscall"
+)
+
+func mapFile(f *os.File, size int64) ([]byte, error) {
+	if size == 0 {
+		return []byte{}, nil
+	}
+
+	return syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+func unmapFile(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,23 @@
+//go:build !unix
+
+package browscap
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile reads the whole file on platforms without mmap support.
+func mapFile(f *os.File, size int64) ([]byte, error) {
+	data := make([]byte, size)
+	_, err := io.ReadFull(f, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func unmapFile(_ []byte) error {
+	return nil
+}
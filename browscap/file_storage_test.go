@@ -0,0 +1,132 @@
+package browscap
+
+import (
+	"bytes"
+	"errors"
+	"github.com/magiconair/properties/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileBrowserStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "browscap.bin")
+
+	writer := NewFileBrowserStorage(path)
+	defer writer.Close()
+
+	_, err := writer.GetVersion()
+	if !errors.Is(err, ErrEmptyCache) {
+		t.Fatalf("expected ErrEmptyCache, got %v", err)
+	}
+
+	err = NewLoader(writer).CompileReader(bytes.NewReader(fixtureWithVersion(t, "6001007")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a separate storage reads the file like another process would
+	reader := NewFileBrowserStorage(path)
+	defer reader.Close()
+
+	bc, err := NewLoader(reader).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := compileAndLoad("fixtures/lite_php_browscap.ini")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, bc.PatternCount(), expected.PatternCount())
+
+	for _, ua := range []string{testUserAgent, "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", ""} {
+		actual, err := bc.GetBrowser(ua)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want, err := expected.GetBrowser(ua)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, actual, want)
+	}
+
+	_, err = reader.Get("no such pattern")
+	if !errors.Is(err, ErrPatternNotFound) {
+		t.Fatalf("expected ErrPatternNotFound, got %v", err)
+	}
+
+	err = NewLoader(writer, WithRecompile(RecompileNewer)).
+		CompileReader(bytes.NewReader(fixtureWithVersion(t, "6001008")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ver, err := reader.GetVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, *ver, Version{Version: 6001008, Type: "LITE"})
+
+	matches, err := filepath.Glob(path + ".*.tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(matches), 0)
+}
+
+func TestFileBrowserStorageExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "browscap.bin")
+
+	writer := NewFileBrowserStorage(path)
+	defer writer.Close()
+
+	err := NewLoader(writer).CompileReader(bytes.NewReader(fixtureWithVersion(t, "6001007")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// lookups work without a GetVersion or Patterns call mapping the file first
+	reader := NewFileBrowserStorage(path)
+	defer reader.Close()
+
+	node, err := reader.Get(DefaultPatternName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, node.Pattern, DefaultPatternName)
+
+	nodes, err := NewFileBrowserStorage(path).GetMany([]string{DefaultPatternName, "no such pattern"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(nodes), 1)
+
+	// the storage is usable, and a compile can finish, while iterating the patterns
+	count := 0
+	for pattern, err := range reader.Patterns() {
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if count == 0 {
+			err = NewLoader(reader, WithRecompile(RecompileNewer)).
+				CompileReader(bytes.NewReader(fixtureWithVersion(t, "6001008")))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		_, err = reader.Get(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count++
+	}
+
+	assert.Equal(t, count > 1, true)
+}
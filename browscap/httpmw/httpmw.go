@@ -0,0 +1,111 @@
+// Package httpmw provides a net/http middleware attaching the browser of the request user agent to the request
+// context.
+package httpmw
+
+import (
+	"context"
+	"errors"
+	"github.com/eugeniypetrov/browscap-go/browscap"
+	"net/http"
+	"sync"
+)
+
+type contextKey struct{}
+
+type Option func(*middleware)
+
+// WithLazy defers the lookup until FromContext is called, so requests whose handlers never ask for the browser
+// don't pay for it.
+func WithLazy(lazy bool) Option {
+	return func(m *middleware) {
+		m.lazy = lazy
+	}
+}
+
+// WithErrorHandler sets a callback called when the browser cannot be resolved for a reason other than no pattern
+// matching the user agent, e.g. a storage failure.
+func WithErrorHandler(fn func(r *http.Request, err error)) Option {
+	return func(m *middleware) {
+		m.onError = fn
+	}
+}
+
+type middleware struct {
+	getter  browscap.BrowserGetter
+	lazy    bool
+	onError func(r *http.Request, err error)
+}
+
+// result resolves the browser at most once per request, with the context of the request rather than the one of
+// whichever FromContext caller comes first, which may be canceled earlier.
+type result struct {
+	once    sync.Once
+	resolve func() (*browscap.Browser, bool)
+	browser *browscap.Browser
+	ok      bool
+}
+
+func (r *result) get() (*browscap.Browser, bool) {
+	r.once.Do(func() {
+		r.browser, r.ok = r.resolve()
+	})
+
+	return r.browser, r.ok
+}
+
+// New returns a middleware resolving the User-Agent header of every request with g.
+func New(g browscap.BrowserGetter, opts ...Option) func(http.Handler) http.Handler {
+	m := &middleware{
+		getter:  g,
+		onError: func(*http.Request, error) {},
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res := &result{
+				resolve: func() (*browscap.Browser, bool) {
+					return m.resolve(r.Context(), r)
+				},
+			}
+
+			if !m.lazy {
+				res.get()
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, res)))
+		})
+	}
+}
+
+func (m *middleware) resolve(ctx context.Context, r *http.Request) (*browscap.Browser, bool) {
+	browser, err := m.getter.GetBrowserContext(ctx, r.UserAgent())
+
+	var warning *browscap.ResolutionWarning
+	switch {
+	case err == nil:
+		return browser, true
+	case errors.As(err, &warning):
+		// the default browser under browscap.ResolveDefault
+		return browser, true
+	case errors.Is(err, browscap.ErrNotFound):
+		return nil, false
+	default:
+		m.onError(r, err)
+		return nil, false
+	}
+}
+
+// FromContext returns the browser of the request the context belongs to. It reports false when the request did not
+// go through the middleware or its user agent could not be resolved.
+func FromContext(ctx context.Context) (*browscap.Browser, bool) {
+	res, ok := ctx.Value(contextKey{}).(*result)
+	if !ok {
+		return nil, false
+	}
+
+	return res.get()
+}
@@ -0,0 +1,79 @@
+package httpmw
+
+import (
+	"context"
+	"github.com/eugeniypetrov/browscap-go/browscap/internal/browscaptest"
+	"github.com/magiconair/properties/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func serve(mw func(http.Handler) http.Handler, ua string, handler http.HandlerFunc) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("User-Agent", ua)
+
+	mw(handler).ServeHTTP(httptest.NewRecorder(), r)
+}
+
+func TestMiddleware(t *testing.T) {
+	getter := &browscaptest.CountingGetter{}
+	mw := New(getter)
+
+	serve(mw, "Chrome", func(w http.ResponseWriter, r *http.Request) {
+		b, ok := FromContext(r.Context())
+		assert.Equal(t, ok, true)
+		assert.Equal(t, b.Browser, "Chrome")
+
+		_, _ = FromContext(r.Context())
+	})
+	assert.Equal(t, getter.Calls.Load(), int32(1))
+
+	serve(mw, "Chrome", func(w http.ResponseWriter, r *http.Request) {})
+	assert.Equal(t, getter.Calls.Load(), int32(2))
+
+	serve(mw, "", func(w http.ResponseWriter, r *http.Request) {
+		_, ok := FromContext(r.Context())
+		assert.Equal(t, ok, false)
+	})
+
+	_, ok := FromContext(context.Background())
+	assert.Equal(t, ok, false)
+}
+
+func TestMiddlewareLazy(t *testing.T) {
+	getter := &browscaptest.CountingGetter{}
+	var errs []error
+	mw := New(getter, WithLazy(true), WithErrorHandler(func(r *http.Request, err error) {
+		errs = append(errs, err)
+	}))
+
+	serve(mw, "Chrome", func(w http.ResponseWriter, r *http.Request) {})
+	assert.Equal(t, getter.Calls.Load(), int32(0))
+
+	serve(mw, "Chrome", func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 2; i++ {
+			b, ok := FromContext(r.Context())
+			assert.Equal(t, ok, true)
+			assert.Equal(t, b.Browser, "Chrome")
+		}
+	})
+	assert.Equal(t, getter.Calls.Load(), int32(1))
+
+	// the lookup does not depend on the context of the first caller
+	serve(mw, "Chrome", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithCancel(r.Context())
+		cancel()
+
+		b, ok := FromContext(ctx)
+		assert.Equal(t, ok, true)
+		assert.Equal(t, b.Browser, "Chrome")
+	})
+	assert.Equal(t, len(errs), 0)
+
+	serve(mw, "failing", func(w http.ResponseWriter, r *http.Request) {
+		_, ok := FromContext(r.Context())
+		assert.Equal(t, ok, false)
+	})
+	assert.Equal(t, len(errs), 1)
+}
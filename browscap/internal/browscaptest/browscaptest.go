@@ -0,0 +1,42 @@
+// Package browscaptest holds the helpers shared by the tests of the browscap packages.
+package browscaptest
+
+import (
+	"context"
+	"errors"
+	"github.com/eugeniypetrov/browscap-go/browscap"
+	"sync/atomic"
+)
+
+// UserAgent is matched by the "chrome 128.0" family of the fixtures.
+const UserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) " +
+	"Chrome/128.0.0.0 Safari/537.36"
+
+// CountingGetter resolves every user agent into a Browser named after it and counts the lookups. An empty user
+// agent is not found and "failing" fails like a storage that is down. Lookups with a canceled context fail.
+type CountingGetter struct {
+	Calls atomic.Int32
+	// Release, when set, blocks every lookup until it is closed
+	Release chan struct{}
+}
+
+func (g *CountingGetter) GetBrowserContext(ctx context.Context, ua string) (*browscap.Browser, error) {
+	g.Calls.Add(1)
+
+	if g.Release != nil {
+		<-g.Release
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	switch ua {
+	case "":
+		return &browscap.Browser{}, browscap.ErrNotFound
+	case "failing":
+		return nil, errors.New("storage is down")
+	default:
+		return &browscap.Browser{Browser: ua}, nil
+	}
+}
@@ -0,0 +1,206 @@
+// Command fieldgen generates the typed field merging, encoding and enumeration code of BrowserNode and Browser,
+// which replaces reflection on the lookup path.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+)
+
+type field struct {
+	name    string
+	typ     string
+	pointer bool
+}
+
+func structFields(f *ast.File, name string) ([]field, error) {
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok || ts.Name.Name != name {
+				continue
+			}
+
+			var fields []field
+			for _, f := range st.Fields.List {
+				fl := field{}
+				typ := f.Type
+				if star, ok := typ.(*ast.StarExpr); ok {
+					fl.pointer = true
+					typ = star.X
+				}
+
+				ident, ok := typ.(*ast.Ident)
+				if !ok {
+					return nil, fmt.Errorf("unsupported type of %s.%s", name, f.Names[0].Name)
+				}
+				fl.typ = ident.Name
+
+				for _, n := range f.Names {
+					fl.name = n.Name
+					fields = append(fields, fl)
+				}
+			}
+
+			return fields, nil
+		}
+	}
+
+	return nil, fmt.Errorf("type %s not found", name)
+}
+
+func zero(typ string) string {
+	switch typ {
+	case "string":
+		return `""`
+	case "bool":
+		return "false"
+	default:
+		return "0"
+	}
+}
+
+// codec returns the name of the nodeEncoder and fileStorageDecoder methods handling fl.
+func codec(fl field) string {
+	if fl.pointer {
+		return fl.typ + "Ptr"
+	}
+
+	return fl.typ
+}
+
+func generate(src, dest string) error {
+	f, err := parser.ParseFile(token.NewFileSet(), src, nil, 0)
+	if err != nil {
+		return fmt.Errorf("error parsing %s: %w", src, err)
+	}
+
+	nodeFields, err := structFields(f, "BrowserNode")
+	if err != nil {
+		return err
+	}
+
+	browserFields, err := structFields(f, "Browser")
+	if err != nil {
+		return err
+	}
+
+	inBrowser := make(map[string]bool)
+	for _, fl := range browserFields {
+		inBrowser[fl.name] = true
+	}
+
+	empty := func(v string, fl field) string {
+		if fl.pointer {
+			return v + "." + fl.name + " == nil"
+		}
+		return v + "." + fl.name + " == " + zero(fl.typ)
+	}
+
+	buf := new(bytes.Buffer)
+	p := func(format string, args ...any) {
+		fmt.Fprintf(buf, format+"\n", args...)
+	}
+
+	p("// Code generated by fieldgen from %s. DO NOT EDIT.", src)
+	p("")
+	p("package browscap")
+	p("")
+	p("// mergeBrowsers sets every field of dest that is not set yet to the value of src.")
+	p("func mergeBrowsers(src, dest *BrowserNode) {")
+	for _, fl := range nodeFields {
+		p("if %s {", empty("dest", fl))
+		p("dest.%[1]s = src.%[1]s", fl.name)
+		p("}")
+	}
+	p("}")
+	p("")
+	p("// suppliedFields returns the names of the Browser fields that merging src into dest would set.")
+	p("func suppliedFields(src, dest *BrowserNode) []string {")
+	p("var fields []string")
+	for _, fl := range nodeFields {
+		if !inBrowser[fl.name] {
+			continue
+		}
+		p("if %s && !(%s) {", empty("dest", fl), empty("src", fl))
+		p("fields = append(fields, %q)", fl.name)
+		p("}")
+	}
+	p("")
+	p("return fields")
+	p("}")
+	p("")
+	// the pattern goes first, so that iterating patterns doesn't need to decode whole records
+	encoded := []field{}
+	for _, fl := range nodeFields {
+		if fl.name == "Pattern" {
+			encoded = append([]field{fl}, encoded...)
+		} else {
+			encoded = append(encoded, fl)
+		}
+	}
+
+	p("// encodeBrowserNode encodes node into a record of the file storage and memory snapshots.")
+	p("func encodeBrowserNode(node *BrowserNode) []byte {")
+	p("e := &nodeEncoder{}")
+	for _, fl := range encoded {
+		p("e.%s(node.%s)", codec(fl), fl.name)
+	}
+	p("")
+	p("return e.buf")
+	p("}")
+	p("")
+	p("// decodeBrowserNode decodes a record written by encodeBrowserNode.")
+	p("func decodeBrowserNode(record []byte) (*BrowserNode, error) {")
+	p("d := &fileStorageDecoder{data: record}")
+	p("node := &BrowserNode{}")
+	for _, fl := range encoded {
+		p("node.%s = d.%s()", fl.name, codec(fl))
+	}
+	p("")
+	p("if d.err != nil {")
+	p("return nil, d.err")
+	p("}")
+	p("")
+	p("return node, nil")
+	p("}")
+	p("")
+	p("// Fields returns the names and values of all fields in declaration order.")
+	p("func (b *Browser) Fields() []BrowserField {")
+	p("return []BrowserField{")
+	for _, fl := range browserFields {
+		p("{Name: %q, Value: b.%s},", fl.name, fl.name)
+	}
+	p("}")
+	p("}")
+
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("error formatting: %w", err)
+	}
+
+	return os.WriteFile(dest, code, 0o644)
+}
+
+func main() {
+	if len(os.Args) != 3 {
+		log.Fatal("usage: fieldgen <source> <destination>")
+	}
+
+	err := generate(os.Args[1], os.Args[2])
+	if err != nil {
+		log.Fatal(err)
+	}
+}
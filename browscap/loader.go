@@ -1,12 +1,14 @@
 package browscap
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	ini "github.com/eugeniypetrov/ini-reader"
 	radix "github.com/eugeniypetrov/radix-tree"
 	"github.com/go-viper/mapstructure/v2"
 	_ "github.com/mattn/go-sqlite3"
+	"io"
 	"os"
 	"strings"
 )
@@ -20,13 +22,31 @@ type Version struct {
 
 var ErrEmptyCache = fmt.Errorf("cache is empty")
 
+var ErrDowngrade = fmt.Errorf("refusing to downgrade cache")
+
+// CompileStats summarizes a compile.
+type CompileStats struct {
+	Version Version
+	// Sections is the number of browser sections read from the ini file
+	Sections int
+	// Saved is the number of sections stored
+	Saved int
+	// Duplicates is the number of sections ignored because an earlier section has the same pattern
+	Duplicates int
+}
+
 type Loader struct {
 	browserStorage BrowserStorage
+	opts           []Option
+	options        *options
+	stats          *CompileStats
 }
 
-func NewLoader(browserStorage BrowserStorage) *Loader {
+func NewLoader(browserStorage BrowserStorage, opts ...Option) *Loader {
 	return &Loader{
 		browserStorage: browserStorage,
+		opts:           opts,
+		options:        newOptions(opts),
 	}
 }
 
@@ -55,17 +75,29 @@ func (l *Loader) parseVersion(s *ini.Section) (*Version, error) {
 	}, nil
 }
 
-func (l *Loader) checkCache(ver *Version) error {
-	cachedVer, err := l.browserStorage.GetVersion()
+// checkCache reports whether the cache has to be (re)built for ver.
+func (l *Loader) checkCache(ctx context.Context, ver *Version, mode RecompileMode) (bool, error) {
+	cachedVer, err := l.browserStorage.GetVersionContext(ctx)
+	if errors.Is(err, ErrEmptyCache) {
+		return true, nil
+	}
 	if err != nil {
-		return fmt.Errorf("error getting version from cache: %w", err)
+		return false, fmt.Errorf("error getting version from cache: %w", err)
 	}
 
-	if *ver != *cachedVer {
-		return fmt.Errorf("version mismatch: %v != %v", *ver, *cachedVer)
+	if *ver == *cachedVer {
+		return mode == RecompileForce, nil
 	}
 
-	return nil
+	if mode == RecompileNever {
+		return false, fmt.Errorf("version mismatch: %v != %v", *ver, *cachedVer)
+	}
+
+	if ver.Version < cachedVer.Version && !l.options.allowDowngrade {
+		return false, fmt.Errorf("%w from %d to %d", ErrDowngrade, cachedVer.Version, ver.Version)
+	}
+
+	return true, nil
 }
 
 func (l *Loader) normalizePattern(pattern string) string {
@@ -97,8 +129,32 @@ func (l *Loader) browserNode(s *ini.Section) (*BrowserNode, error) {
 	return res, nil
 }
 
-func (l *Loader) storeCache(node *BrowserNode) error {
-	err := l.browserStorage.Save(node)
+// flattenNode merges the already flattened parent into node. A node whose parent has not been read yet is kept as
+// it is and gets resolved at lookup time.
+func (l *Loader) flattenNode(node *BrowserNode, flattened map[string]*BrowserNode) *BrowserNode {
+	if node.Pattern == DefaultPatternName {
+		res := *node
+		mergeBrowsers(DefaultBrowser, &res)
+		flattened[node.Pattern] = &res
+
+		return node
+	}
+
+	parent, ok := flattened[node.Parent]
+	if !ok {
+		return node
+	}
+
+	res := *node
+	mergeBrowsers(parent, &res)
+	res.Parent = flattenedParent
+	flattened[node.Pattern] = &res
+
+	return &res
+}
+
+func (l *Loader) storeCache(ctx context.Context, node *BrowserNode) error {
+	err := l.browserStorage.SaveContext(ctx, node)
 	if err != nil {
 		return fmt.Errorf("error saving cache: %w", err)
 	}
@@ -106,8 +162,8 @@ func (l *Loader) storeCache(node *BrowserNode) error {
 	return nil
 }
 
-func (l *Loader) storeVersion(ver *Version) error {
-	err := l.browserStorage.SaveVersion(ver)
+func (l *Loader) storeVersion(ctx context.Context, ver *Version) error {
+	err := l.browserStorage.SaveVersionContext(ctx, ver)
 	if err != nil {
 		return fmt.Errorf("error saving version: %w", err)
 	}
@@ -115,10 +171,31 @@ func (l *Loader) storeVersion(ver *Version) error {
 	return nil
 }
 
-func (l *Loader) makeCache(r *ini.Reader, ver *Version) error {
-	err := l.browserStorage.Prepare()
+func (l *Loader) makeCache(ctx context.Context, r *ini.Reader, ver *Version) (stats *CompileStats, err error) {
+	err = l.browserStorage.PrepareContext(ctx)
 	if err != nil {
-		return fmt.Errorf("error preparing cache: %w", err)
+		return nil, fmt.Errorf("error preparing cache: %w", err)
+	}
+
+	defer func() {
+		rb, ok := l.browserStorage.(Rollbacker)
+		if err == nil || !ok {
+			return
+		}
+
+		// ctx may be the reason of the failure, but the partial data must be removed anyway
+		rbErr := rb.RollbackContext(context.WithoutCancel(ctx))
+		if rbErr != nil {
+			err = errors.Join(err, fmt.Errorf("error rolling back cache: %w", rbErr))
+		}
+	}()
+
+	stats = &CompileStats{Version: *ver}
+	seen := make(map[string]struct{})
+
+	var flattened map[string]*BrowserNode
+	if l.options.flatten {
+		flattened = make(map[string]*BrowserNode)
 	}
 
 	for r.Next() {
@@ -130,36 +207,88 @@ func (l *Loader) makeCache(r *ini.Reader, ver *Version) error {
 
 		node, err := l.browserNode(s)
 		if err != nil {
-			return fmt.Errorf("error creating browser node: %w", err)
+			return nil, fmt.Errorf("error creating browser node: %w", err)
+		}
+
+		stats.Sections++
+
+		// the first section of a pattern wins
+		if _, ok := seen[node.Pattern]; ok {
+			stats.Duplicates++
+			continue
+		}
+		seen[node.Pattern] = struct{}{}
+
+		if flattened != nil {
+			node = l.flattenNode(node, flattened)
 		}
 
-		err = l.storeCache(node)
+		err = l.storeCache(ctx, node)
 		if err != nil {
-			return fmt.Errorf("error storing cache: %w", err)
+			return nil, fmt.Errorf("error storing cache: %w", err)
 		}
+
+		stats.Saved++
 	}
 
 	err = r.Err()
 	if err != nil {
-		return fmt.Errorf("error reading ini: %w", err)
+		return nil, fmt.Errorf("error reading ini: %w", err)
 	}
 
-	err = l.storeVersion(ver)
+	err = l.storeVersion(ctx, ver)
 	if err != nil {
-		return fmt.Errorf("error storing version: %w", err)
+		return nil, fmt.Errorf("error storing version: %w", err)
 	}
 
-	return nil
+	return stats, nil
 }
 
 func (l *Loader) Compile(filename string) error {
+	return l.CompileContext(context.Background(), filename)
+}
+
+func (l *Loader) CompileContext(ctx context.Context, filename string) error {
 	f, err := os.Open(filename)
 	if err != nil {
 		return fmt.Errorf("error opening file: %w", err)
 	}
 	defer f.Close()
 
-	r := ini.NewReader(f)
+	return l.CompileReaderContext(ctx, f)
+}
+
+// CompileReader compiles the browscap ini file read from r, e.g. an embedded file or an HTTP response body.
+// Gzip, bzip2 and single-file zip input is detected and decompressed on the fly.
+func (l *Loader) CompileReader(r io.Reader) error {
+	return l.CompileReaderContext(context.Background(), r)
+}
+
+func (l *Loader) CompileReaderContext(ctx context.Context, rd io.Reader) error {
+	return l.compileReader(ctx, rd, l.options.recompileMode)
+}
+
+func (l *Loader) compileReader(ctx context.Context, rd io.Reader, mode RecompileMode) (err error) {
+	ctx, span := l.options.tracer.Start(ctx, "browscap.Compile")
+	defer func() {
+		if l.stats != nil {
+			span.SetAttributes(
+				attrSections.Int(l.stats.Sections),
+				attrDuplicates.Int(l.stats.Duplicates),
+			)
+		}
+		span.SetAttributes(attrCompiled.Bool(l.stats != nil))
+		endSpan(span, err)
+	}()
+
+	l.stats = nil
+
+	rd, err = decompress(rd)
+	if err != nil {
+		return fmt.Errorf("error decompressing: %w", err)
+	}
+
+	r := ini.NewReader(rd)
 
 	h := r.Next()
 	if !h {
@@ -171,17 +300,19 @@ func (l *Loader) Compile(filename string) error {
 		return fmt.Errorf("error parsing version: %w", err)
 	}
 
-	err = l.checkCache(ver)
-	if err == nil {
-		// already compiled
-		return nil
-	}
+	span.SetAttributes(attrVersion.Int(ver.Version))
 
-	if !errors.Is(err, ErrEmptyCache) {
+	compile, err := l.checkCache(ctx, ver, mode)
+	if err != nil {
 		return fmt.Errorf("invalid cache: %w", err)
 	}
 
-	err = l.makeCache(r, ver)
+	if !compile {
+		// already compiled
+		return nil
+	}
+
+	l.stats, err = l.makeCache(ctx, r, ver)
 	if err != nil {
 		return fmt.Errorf("error making cache: %w", err)
 	}
@@ -189,19 +320,79 @@ func (l *Loader) Compile(filename string) error {
 	return nil
 }
 
+// Stats returns the summary of the last compile, nil if it has been skipped or failed.
+func (l *Loader) Stats() *CompileStats {
+	return l.stats
+}
+
 func (l *Loader) Load() (*Browscap, error) {
+	return l.LoadContext(context.Background())
+}
+
+func (l *Loader) LoadContext(ctx context.Context) (bc *Browscap, err error) {
+	ctx, span := l.options.tracer.Start(ctx, "browscap.Load")
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	storage, generation, err := l.pin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ver, err := storage.GetVersionContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting version: %w", err)
+	}
+
+	span.SetAttributes(attrVersion.Int(ver.Version))
+
 	tree := radix.NewRadix()
+	count := 0
 
-	for pattern, err := range l.browserStorage.Patterns() {
+	for pattern, err := range storage.PatternsContext(ctx) {
 		if err != nil {
 			return nil, fmt.Errorf("error getting pattern: %w", err)
 		}
 
 		tree.Add(pattern)
+		count++
 	}
 
+	span.SetAttributes(attrPatterns.Int(count))
+
+	return l.newBrowscap(tree, storage, generation, ver, count), nil
+}
+
+// pin returns the storage a new Browscap reads from along with its generation, see Pinner.
+func (l *Loader) pin(ctx context.Context) (BrowserStorage, int64, error) {
+	p, ok := l.browserStorage.(Pinner)
+	if !ok {
+		return l.browserStorage, 0, nil
+	}
+
+	storage, generation, err := p.PinContext(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error pinning generation: %w", err)
+	}
+
+	return storage, generation, nil
+}
+
+func (l *Loader) newBrowscap(
+	tree *radix.Node,
+	storage BrowserStorage,
+	generation int64,
+	ver *Version,
+	patternCount int,
+) *Browscap {
 	// convert to Directed Acyclic Word Graph, this significantly reduces memory usage
 	tree = tree.ToDAWG()
 
-	return NewBrowscap(tree, l.browserStorage), nil
+	bc := NewBrowscap(tree, storage, l.opts...)
+	bc.version = ver
+	bc.generation = generation
+	bc.patternCount = patternCount
+
+	return bc
 }
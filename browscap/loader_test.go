@@ -0,0 +1,160 @@
+package browscap
+
+import (
+	"bytes"
+	"errors"
+	"github.com/magiconair/properties/assert"
+	"os"
+	"testing"
+)
+
+func fixtureWithVersion(t *testing.T, version string) []byte {
+	data, err := os.ReadFile("fixtures/lite_php_browscap.ini")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bytes.Replace(data, []byte("Version=6001007"), []byte("Version="+version), 1)
+}
+
+func TestRecompile(t *testing.T) {
+	db := openSqlite(t)
+
+	storage := NewSqliteBrowserStorage(db)
+
+	older := fixtureWithVersion(t, "6001007")
+	newer := fixtureWithVersion(t, "6001008")
+
+	assertVersion := func(expected int) {
+		ver, err := storage.GetVersion()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, ver.Version, expected)
+	}
+
+	err := NewLoader(storage).CompileReader(bytes.NewReader(older))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertVersion(6001007)
+
+	err = NewLoader(storage).CompileReader(bytes.NewReader(newer))
+	if err == nil {
+		t.Fatal("expected version mismatch error")
+	}
+
+	err = NewLoader(storage, WithRecompile(RecompileNewer)).CompileReader(bytes.NewReader(newer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertVersion(6001008)
+
+	err = NewLoader(storage, WithRecompile(RecompileForce)).CompileReader(bytes.NewReader(older))
+	if !errors.Is(err, ErrDowngrade) {
+		t.Fatalf("expected ErrDowngrade, got %v", err)
+	}
+	assertVersion(6001008)
+
+	err = NewLoader(storage, WithRecompile(RecompileNewer), WithAllowDowngrade(true)).
+		CompileReader(bytes.NewReader(older))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertVersion(6001007)
+
+	err = NewLoader(storage, WithRecompile(RecompileForce)).CompileReader(bytes.NewReader(older))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertVersion(6001007)
+
+	bc, err := NewLoader(storage).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := bc.GetBrowser(testUserAgent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, b.Browser, "Chrome")
+}
+
+func TestCompileStats(t *testing.T) {
+	storage := NewMemoryBrowserStorage()
+	loader := NewLoader(storage, WithRecompile(RecompileNewer))
+
+	err := loader.CompileReader(bytes.NewReader(fixtureWithVersion(t, "6001007")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, *loader.Stats(), CompileStats{
+		Version:    Version{Version: 6001007, Type: "LITE"},
+		Sections:   9978,
+		Saved:      9977,
+		Duplicates: 1,
+	})
+
+	err = loader.CompileReader(bytes.NewReader(fixtureWithVersion(t, "6001007")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loader.Stats() != nil {
+		t.Fatal("expected no stats for a skipped compile")
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	load := func(opts ...Option) (*Browscap, *MemoryBrowserStorage) {
+		storage := NewMemoryBrowserStorage()
+		loader := NewLoader(storage, opts...)
+
+		err := loader.Compile("fixtures/lite_php_browscap.ini")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bc, err := loader.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return bc, storage
+	}
+
+	merged, mergedStorage := load()
+	flat, flatStorage := load(WithFlatten(true))
+
+	count := 0
+	for pattern, err := range mergedStorage.Patterns() {
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected, err := merged.resolveBrowser(pattern, mergedStorage.Get)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gets := 0
+		actual, err := flat.resolveBrowser(pattern, func(pattern string) (*BrowserNode, error) {
+			gets++
+			return flatStorage.Get(pattern)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, actual, expected, pattern)
+		if pattern != DefaultPatternName {
+			assert.Equal(t, gets, 1, pattern)
+		}
+
+		count++
+	}
+
+	assert.Equal(t, count, 9977)
+}
@@ -1,59 +1,400 @@
 package browscap
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	lru "github.com/hashicorp/golang-lru/v2"
 	"iter"
+	"sync/atomic"
+	"time"
 )
 
+type LRUCachedStorageOption func(*LRUCachedStorage)
+
+// WithPreload loads the given patterns along with all their ancestors into the cache on construction.
+func WithPreload(patterns ...string) LRUCachedStorageOption {
+	return func(s *LRUCachedStorage) {
+		s.preload = append(s.preload, patterns...)
+	}
+}
+
+// WithPreloadAncestors loads every pattern that is the parent of another one into the cache on construction. Every
+// lookup walks these, so they are the hottest ones. It reads all patterns once, which takes a while.
+func WithPreloadAncestors() LRUCachedStorageOption {
+	return func(s *LRUCachedStorage) {
+		s.preloadAncestors = true
+	}
+}
+
+// LRUCacheStats is a snapshot of the LRUCachedStorage counters.
+type LRUCacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Len       int
+	// BackendCalls is the number of requests to the underlying storage and BackendLatency their total duration
+	BackendCalls   uint64
+	BackendLatency time.Duration
+}
+
+type lruCounters struct {
+	hits           atomic.Uint64
+	misses         atomic.Uint64
+	evictions      atomic.Uint64
+	backendCalls   atomic.Uint64
+	backendLatency atomic.Int64
+}
+
+// unpinned is the generation of the nodes read through the LRUCachedStorage itself rather than through a view
+// returned by Pin.
+const unpinned = -1
+
+type lruKey struct {
+	generation int64
+	pattern    string
+}
+
+// LRUCachedStorage caches the nodes read from the underlying storage. When that is a Pinner, so is the
+// LRUCachedStorage: its views share the cache and the counters, and cache nodes by generation. Nodes read through
+// the LRUCachedStorage itself are cached regardless of the generation they come from.
 type LRUCachedStorage struct {
-	cache   *lru.Cache[string, *BrowserNode]
-	storage BrowserStorage
+	cache            *lru.Cache[lruKey, *BrowserNode]
+	storage          BrowserStorage
+	generation       int64
+	preload          []string
+	preloadAncestors bool
+	counters         *lruCounters
 }
 
-func NewLRUCachedStorage(storage BrowserStorage, cacheSize int) (*LRUCachedStorage, error) {
-	cache, err := lru.New[string, *BrowserNode](cacheSize)
+func NewLRUCachedStorage(storage BrowserStorage, cacheSize int, opts ...LRUCachedStorageOption) (*LRUCachedStorage, error) {
+	s := &LRUCachedStorage{
+		storage:    storage,
+		generation: unpinned,
+		counters:   &lruCounters{},
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	counters := s.counters
+	cache, err := lru.NewWithEvict[lruKey, *BrowserNode](cacheSize, func(lruKey, *BrowserNode) {
+		counters.evictions.Add(1)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("unable to create cache. %w", err)
 	}
+	s.cache = cache
+
+	ctx := context.Background()
+
+	if s.preloadAncestors {
+		err = s.PreloadAncestors(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error preloading ancestors: %w", err)
+		}
+	}
+
+	if len(s.preload) > 0 {
+		err = s.Preload(ctx, s.preload)
+		if err != nil {
+			return nil, fmt.Errorf("error preloading: %w", err)
+		}
+	}
+
+	return s, nil
+}
+
+// Stats returns a snapshot of the cache counters.
+func (s *LRUCachedStorage) Stats() LRUCacheStats {
+	return LRUCacheStats{
+		Hits:           s.counters.hits.Load(),
+		Misses:         s.counters.misses.Load(),
+		Evictions:      s.counters.evictions.Load(),
+		Len:            s.cache.Len(),
+		BackendCalls:   s.counters.backendCalls.Load(),
+		BackendLatency: time.Duration(s.counters.backendLatency.Load()),
+	}
+}
+
+func (s *LRUCachedStorage) key(pattern string) lruKey {
+	return lruKey{
+		generation: s.generation,
+		pattern:    pattern,
+	}
+}
+
+func (s *LRUCachedStorage) Pin() (BrowserStorage, int64, error) {
+	return s.PinContext(context.Background())
+}
+
+// PinContext returns a view of the underlying storage pinned to its active generation, or the LRUCachedStorage
+// itself when the underlying storage is not a Pinner.
+func (s *LRUCachedStorage) PinContext(ctx context.Context) (BrowserStorage, int64, error) {
+	p, ok := s.storage.(Pinner)
+	if !ok {
+		return s, 0, nil
+	}
+
+	storage, generation, err := p.PinContext(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	view := *s
+	view.storage = storage
+	view.generation = generation
+
+	return &view, generation, nil
+}
+
+// pinned returns the view the nodes are preloaded into, so that Browscaps loaded from the active generation find
+// them.
+func (s *LRUCachedStorage) pinned(ctx context.Context) (*LRUCachedStorage, error) {
+	view, _, err := s.PinContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error pinning generation: %w", err)
+	}
+
+	return view.(*LRUCachedStorage), nil
+}
 
-	return &LRUCachedStorage{
-		cache:   cache,
-		storage: storage,
-	}, nil
+func (s *LRUCachedStorage) observe(start time.Time) {
+	s.counters.backendCalls.Add(1)
+	s.counters.backendLatency.Add(int64(time.Since(start)))
+}
+
+// fetch gets the patterns from the underlying storage, in a single request when it supports that. Patterns that are
+// not found are omitted.
+func (s *LRUCachedStorage) fetch(ctx context.Context, patterns []string) (map[string]*BrowserNode, error) {
+	if bs, ok := s.storage.(BatchBrowserStorage); ok {
+		defer s.observe(time.Now())
+		return bs.GetManyContext(ctx, patterns)
+	}
+
+	res := make(map[string]*BrowserNode, len(patterns))
+	for _, pattern := range patterns {
+		start := time.Now()
+		node, err := s.storage.GetContext(ctx, pattern)
+		s.observe(start)
+
+		if errors.Is(err, ErrPatternNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		res[pattern] = node
+	}
+
+	return res, nil
+}
+
+// Preload loads the patterns along with all their ancestors into the cache.
+func (s *LRUCachedStorage) Preload(ctx context.Context, patterns []string) error {
+	s, err := s.pinned(ctx)
+	if err != nil {
+		return err
+	}
+
+	return s.preloadPatterns(ctx, patterns)
+}
+
+func (s *LRUCachedStorage) preloadPatterns(ctx context.Context, patterns []string) error {
+	requested := make(map[string]bool, len(patterns))
+	for _, pattern := range patterns {
+		requested[pattern] = true
+	}
+
+	for len(patterns) > 0 {
+		nodes, err := s.fetch(ctx, patterns)
+		if err != nil {
+			return fmt.Errorf("error getting nodes: %w", err)
+		}
+
+		var next []string
+		for pattern, node := range nodes {
+			s.cache.Add(s.key(pattern), node)
+
+			if pattern == DefaultPatternName || isFlattened(node) || requested[node.Parent] {
+				continue
+			}
+
+			requested[node.Parent] = true
+			next = append(next, node.Parent)
+		}
+
+		patterns = next
+	}
+
+	return nil
+}
+
+// PreloadAncestors loads every pattern that is the parent of another one into the cache.
+func (s *LRUCachedStorage) PreloadAncestors(ctx context.Context) error {
+	const batchSize = 500
+
+	s, err := s.pinned(ctx)
+	if err != nil {
+		return err
+	}
+
+	parents := make(map[string]struct{})
+	batch := make([]string, 0, batchSize)
+
+	collect := func() error {
+		nodes, err := s.fetch(ctx, batch)
+		if err != nil {
+			return fmt.Errorf("error getting nodes: %w", err)
+		}
+
+		for pattern, node := range nodes {
+			if pattern != DefaultPatternName && !isFlattened(node) {
+				parents[node.Parent] = struct{}{}
+			}
+		}
+		batch = batch[:0]
+
+		return nil
+	}
+
+	for pattern, err := range s.storage.PatternsContext(ctx) {
+		if err != nil {
+			return fmt.Errorf("error getting patterns: %w", err)
+		}
+
+		batch = append(batch, pattern)
+		if len(batch) == batchSize {
+			err = collect()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = collect()
+	if err != nil {
+		return err
+	}
+
+	patterns := make([]string, 0, len(parents))
+	for pattern := range parents {
+		patterns = append(patterns, pattern)
+	}
+
+	return s.preloadPatterns(ctx, patterns)
 }
 
 func (s *LRUCachedStorage) Prepare() error {
 	return s.storage.Prepare()
 }
 
+func (s *LRUCachedStorage) PrepareContext(ctx context.Context) error {
+	return s.storage.PrepareContext(ctx)
+}
+
+func (s *LRUCachedStorage) Rollback() error {
+	return s.RollbackContext(context.Background())
+}
+
+func (s *LRUCachedStorage) RollbackContext(ctx context.Context) error {
+	if r, ok := s.storage.(Rollbacker); ok {
+		return r.RollbackContext(ctx)
+	}
+
+	return nil
+}
+
 func (s *LRUCachedStorage) GetVersion() (*Version, error) {
 	return s.storage.GetVersion()
 }
 
+func (s *LRUCachedStorage) GetVersionContext(ctx context.Context) (*Version, error) {
+	return s.storage.GetVersionContext(ctx)
+}
+
 func (s *LRUCachedStorage) SaveVersion(ver *Version) error {
 	return s.storage.SaveVersion(ver)
 }
 
+func (s *LRUCachedStorage) SaveVersionContext(ctx context.Context, ver *Version) error {
+	return s.storage.SaveVersionContext(ctx, ver)
+}
+
 func (s *LRUCachedStorage) Save(node *BrowserNode) error {
 	return s.storage.Save(node)
 }
 
+func (s *LRUCachedStorage) SaveContext(ctx context.Context, node *BrowserNode) error {
+	return s.storage.SaveContext(ctx, node)
+}
+
 func (s *LRUCachedStorage) Get(pattern string) (*BrowserNode, error) {
-	if node, ok := s.cache.Get(pattern); ok {
+	return s.GetContext(context.Background(), pattern)
+}
+
+func (s *LRUCachedStorage) GetContext(ctx context.Context, pattern string) (*BrowserNode, error) {
+	if node, ok := s.cache.Get(s.key(pattern)); ok {
+		s.counters.hits.Add(1)
 		return node, nil
 	}
 
-	node, err := s.storage.Get(pattern)
+	s.counters.misses.Add(1)
+
+	start := time.Now()
+	node, err := s.storage.GetContext(ctx, pattern)
+	s.observe(start)
 	if err != nil {
 		return nil, err
 	}
 
-	s.cache.Add(pattern, node)
+	s.cache.Add(s.key(pattern), node)
 
 	return node, nil
 }
 
+func (s *LRUCachedStorage) GetMany(patterns []string) (map[string]*BrowserNode, error) {
+	return s.GetManyContext(context.Background(), patterns)
+}
+
+func (s *LRUCachedStorage) GetManyContext(ctx context.Context, patterns []string) (map[string]*BrowserNode, error) {
+	res := make(map[string]*BrowserNode, len(patterns))
+
+	var missing []string
+	for _, pattern := range patterns {
+		if node, ok := s.cache.Get(s.key(pattern)); ok {
+			res[pattern] = node
+			continue
+		}
+		missing = append(missing, pattern)
+	}
+
+	s.counters.hits.Add(uint64(len(patterns) - len(missing)))
+	s.counters.misses.Add(uint64(len(missing)))
+
+	if len(missing) == 0 {
+		return res, nil
+	}
+
+	fetched, err := s.fetch(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	for pattern, node := range fetched {
+		s.cache.Add(s.key(pattern), node)
+		res[pattern] = node
+	}
+
+	return res, nil
+}
+
 func (s *LRUCachedStorage) Patterns() iter.Seq2[string, error] {
 	return s.storage.Patterns()
 }
+
+func (s *LRUCachedStorage) PatternsContext(ctx context.Context) iter.Seq2[string, error] {
+	return s.storage.PatternsContext(ctx)
+}
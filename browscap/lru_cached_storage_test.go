@@ -0,0 +1,139 @@
+package browscap
+
+import (
+	"bytes"
+	"github.com/magiconair/properties/assert"
+	"strings"
+	"testing"
+)
+
+func TestLRUCachedStorageStats(t *testing.T) {
+	storage := NewMemoryBrowserStorage()
+	err := NewLoader(storage).Compile("fixtures/lite_php_browscap.ini")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cached, err := NewLRUCachedStorage(storage, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pattern := range []string{DefaultPatternName, DefaultPatternName, "*"} {
+		_, err = cached.Get(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := cached.Stats()
+	assert.Equal(t, stats.Hits, uint64(1))
+	assert.Equal(t, stats.Misses, uint64(2))
+	assert.Equal(t, stats.Evictions, uint64(1))
+	assert.Equal(t, stats.Len, 1)
+	assert.Equal(t, stats.BackendCalls, uint64(2))
+
+	// the chain of the Chrome 128 pattern, down to defaultproperties
+	nodes := chain(t, testUserAgent)
+	cached, err = NewLRUCachedStorage(storage, 100, WithPreload(nodes[0].Pattern))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, cached.Stats().Len, len(nodes)-1)
+	for _, node := range nodes[:len(nodes)-1] {
+		_, err = cached.Get(node.Pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Equal(t, cached.Stats().Misses, uint64(0))
+}
+
+func TestLRUCachedStoragePreloadAncestors(t *testing.T) {
+	// nodes of a Pinner are preloaded for the generation the Browscap is loaded from
+	for _, storage := range []BrowserStorage{NewMemoryBrowserStorage(), NewSqliteBrowserStorage(openSqlite(t))} {
+		loader := NewLoader(storage)
+		err := loader.Compile("fixtures/lite_php_browscap.ini")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cached, err := NewLRUCachedStorage(storage, 10000, WithPreloadAncestors())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bc, err := NewLoader(cached).Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		view := bc.browserStorage.(*LRUCachedStorage)
+		if !view.cache.Contains(view.key(DefaultPatternName)) || !view.cache.Contains(view.key("chrome 128.0")) {
+			t.Fatal("expected ancestors to be preloaded")
+		}
+
+		_, err = bc.GetBrowser(testUserAgent)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// only the matched pattern itself is not an ancestor
+		assert.Equal(t, cached.Stats().Misses, uint64(1))
+	}
+}
+
+func TestLRUCachedStoragePinned(t *testing.T) {
+	storage := NewSqliteBrowserStorage(openSqlite(t))
+
+	err := NewLoader(storage).CompileReader(bytes.NewReader(fixtureWithVersion(t, "6001007")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cached, err := NewLRUCachedStorage(storage, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bc, err := NewLoader(cached).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the new version knows nothing about Chrome
+	err = NewLoader(storage, WithRecompile(RecompileNewer)).CompileReader(strings.NewReader(`
+[GJK_Browscap_Version]
+Version=6001008
+Format=php
+Type=LITE
+
+[DefaultProperties]
+Browser="DefaultProperties"
+
+[*]
+Parent="DefaultProperties"
+Browser="Default Browser"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := bc.GetBrowser(testUserAgent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, b.Browser, "Chrome")
+
+	reloaded, err := NewLoader(cached).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err = reloaded.GetBrowser(testUserAgent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, b.Browser, "Default Browser")
+}
@@ -0,0 +1,213 @@
+package browscap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// The snapshot layout is
+//
+//	magic "BCMEM", format version byte
+//	browscap version (uvarint), type (uvarint length + bytes)
+//	node count (uvarint)
+//	nodes: uvarint length + record encoded like FileBrowserStorage records
+//	crc32 (IEEE, little endian) of everything above
+var memorySnapshotMagic = []byte("BCMEM")
+
+const (
+	memorySnapshotFormat = 1
+	maxRecordSize        = 1 << 20
+)
+
+type snapshotWriter struct {
+	w   *bufio.Writer
+	crc io.Writer
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func (sw *snapshotWriter) write(p []byte) {
+	if sw.err != nil {
+		return
+	}
+
+	_, sw.err = sw.w.Write(p)
+	_, _ = sw.crc.Write(p)
+}
+
+func (sw *snapshotWriter) uvarint(v uint64) {
+	n := binary.PutUvarint(sw.buf[:], v)
+	sw.write(sw.buf[:n])
+}
+
+func (sw *snapshotWriter) string(s string) {
+	sw.uvarint(uint64(len(s)))
+	sw.write([]byte(s))
+}
+
+type snapshotReader struct {
+	r   *bufio.Reader
+	crc io.Writer
+}
+
+func (sr *snapshotReader) ReadByte() (byte, error) {
+	c, err := sr.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	_, _ = sr.crc.Write([]byte{c})
+
+	return c, nil
+}
+
+func (sr *snapshotReader) read(p []byte) error {
+	_, err := io.ReadFull(sr.r, p)
+	if err != nil {
+		return err
+	}
+
+	_, _ = sr.crc.Write(p)
+
+	return nil
+}
+
+func (sr *snapshotReader) uvarint() (uint64, error) {
+	return binary.ReadUvarint(sr)
+}
+
+func (sr *snapshotReader) bytes(maxLen int) ([]byte, error) {
+	l, err := sr.uvarint()
+	if err != nil {
+		return nil, err
+	}
+
+	if l > uint64(maxLen) {
+		return nil, fmt.Errorf("invalid length %d", l)
+	}
+
+	p := make([]byte, l)
+
+	return p, sr.read(p)
+}
+
+// WriteSnapshot writes the version and all nodes to w, so that the storage can be restored with
+// LoadMemoryBrowserStorage instead of compiling the ini file again.
+func (s *MemoryBrowserStorage) WriteSnapshot(w io.Writer) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.version == nil {
+		return ErrEmptyCache
+	}
+
+	crc := crc32.NewIEEE()
+	sw := &snapshotWriter{
+		w:   bufio.NewWriter(w),
+		crc: crc,
+	}
+
+	sw.write(memorySnapshotMagic)
+	sw.write([]byte{memorySnapshotFormat})
+	sw.uvarint(uint64(s.version.Version))
+	sw.string(s.version.Type)
+	sw.uvarint(uint64(len(s.nodes)))
+
+	for _, node := range s.nodes {
+		record := encodeBrowserNode(node)
+		sw.uvarint(uint64(len(record)))
+		sw.write(record)
+	}
+
+	if sw.err != nil {
+		return fmt.Errorf("error writing snapshot: %w", sw.err)
+	}
+
+	_, err := sw.w.Write(binary.LittleEndian.AppendUint32(nil, crc.Sum32()))
+	if err != nil {
+		return fmt.Errorf("error writing snapshot: %w", err)
+	}
+
+	err = sw.w.Flush()
+	if err != nil {
+		return fmt.Errorf("error writing snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// LoadMemoryBrowserStorage restores a storage from a snapshot written by MemoryBrowserStorage.WriteSnapshot.
+func LoadMemoryBrowserStorage(r io.Reader) (*MemoryBrowserStorage, error) {
+	crc := crc32.NewIEEE()
+	sr := &snapshotReader{
+		r:   bufio.NewReader(r),
+		crc: crc,
+	}
+
+	header := make([]byte, len(memorySnapshotMagic)+1)
+	err := sr.read(header)
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot header: %w", err)
+	}
+
+	if !bytes.Equal(header[:len(memorySnapshotMagic)], memorySnapshotMagic) {
+		return nil, fmt.Errorf("not a browscap snapshot")
+	}
+
+	if header[len(memorySnapshotMagic)] != memorySnapshotFormat {
+		return nil, fmt.Errorf("unsupported snapshot format %d", header[len(memorySnapshotMagic)])
+	}
+
+	verNum, err := sr.uvarint()
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot version: %w", err)
+	}
+
+	verType, err := sr.bytes(255)
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot type: %w", err)
+	}
+
+	count, err := sr.uvarint()
+	if err != nil {
+		return nil, fmt.Errorf("error reading node count: %w", err)
+	}
+
+	s := NewMemoryBrowserStorage()
+	for i := uint64(0); i < count; i++ {
+		record, err := sr.bytes(maxRecordSize)
+		if err != nil {
+			return nil, fmt.Errorf("error reading node %d: %w", i, err)
+		}
+
+		node, err := decodeBrowserNode(record)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding node %d: %w", i, err)
+		}
+
+		s.index[s.hash(node.Pattern)] = len(s.nodes)
+		s.nodes = append(s.nodes, node)
+	}
+
+	sum := crc.Sum32()
+	trailer := make([]byte, 4)
+	_, err = io.ReadFull(sr.r, trailer)
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot checksum: %w", err)
+	}
+
+	if binary.LittleEndian.Uint32(trailer) != sum {
+		return nil, fmt.Errorf("snapshot checksum mismatch")
+	}
+
+	s.version = &Version{
+		Version: int(verNum),
+		Type:    string(verType),
+	}
+
+	return s, nil
+}
@@ -0,0 +1,46 @@
+package browscap
+
+import (
+	"bytes"
+	"errors"
+	"github.com/magiconair/properties/assert"
+	"testing"
+)
+
+func TestMemorySnapshot(t *testing.T) {
+	storage := NewMemoryBrowserStorage()
+
+	err := storage.WriteSnapshot(new(bytes.Buffer))
+	if !errors.Is(err, ErrEmptyCache) {
+		t.Fatalf("expected ErrEmptyCache, got %v", err)
+	}
+
+	err = NewLoader(storage).Compile("fixtures/lite_php_browscap.ini")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	err = storage.WriteSnapshot(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot := buf.Bytes()
+
+	restored, err := LoadMemoryBrowserStorage(bytes.NewReader(snapshot))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, restored.version, storage.version)
+	assert.Equal(t, restored.nodes, storage.nodes)
+	assert.Equal(t, restored.index, storage.index)
+
+	corrupted := bytes.Clone(snapshot)
+	corrupted[len(corrupted)/2] ^= 0xff
+	_, err = LoadMemoryBrowserStorage(bytes.NewReader(corrupted))
+	if err == nil {
+		t.Fatal("expected error loading corrupted snapshot")
+	}
+}
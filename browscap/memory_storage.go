@@ -1,27 +1,53 @@
 package browscap
 
 import (
+	"context"
 	"fmt"
 	"github.com/zeebo/xxh3"
 	"iter"
+	"sync"
 )
 
+// MemoryBrowserStorage keeps browsers in memory in the order they were saved. It is safe for concurrent use.
+//
+// A compile is built aside and swapped in once the version is saved, so readers keep getting the previous data
+// until then and a failed compile leaves it untouched.
 type MemoryBrowserStorage struct {
-	version  *Version
-	browsers map[uint64]*BrowserNode
+	mu      sync.RWMutex
+	version *Version
+	nodes   []*BrowserNode
+	// index maps pattern hashes to positions in nodes
+	index map[uint64]int
+
+	// compile state, only used by the compiling goroutine
+	stagedNodes []*BrowserNode
+	stagedIndex map[uint64]int
 }
 
 func NewMemoryBrowserStorage() *MemoryBrowserStorage {
 	return &MemoryBrowserStorage{
-		browsers: make(map[uint64]*BrowserNode),
+		index: make(map[uint64]int),
 	}
 }
 
 func (s *MemoryBrowserStorage) Prepare() error {
+	return s.PrepareContext(context.Background())
+}
+
+func (s *MemoryBrowserStorage) PrepareContext(_ context.Context) error {
+	s.stagedNodes = nil
+	s.stagedIndex = make(map[uint64]int)
 	return nil
 }
 
 func (s *MemoryBrowserStorage) GetVersion() (*Version, error) {
+	return s.GetVersionContext(context.Background())
+}
+
+func (s *MemoryBrowserStorage) GetVersionContext(_ context.Context) (*Version, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	if s.version == nil {
 		return nil, ErrEmptyCache
 	}
@@ -30,34 +56,137 @@ func (s *MemoryBrowserStorage) GetVersion() (*Version, error) {
 }
 
 func (s *MemoryBrowserStorage) SaveVersion(ver *Version) error {
+	return s.SaveVersionContext(context.Background(), ver)
+}
+
+// SaveVersionContext completes the compile by swapping its browsers in.
+func (s *MemoryBrowserStorage) SaveVersionContext(_ context.Context, ver *Version) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stagedIndex != nil {
+		s.nodes = s.stagedNodes
+		s.index = s.stagedIndex
+		s.stagedNodes = nil
+		s.stagedIndex = nil
+	}
+
 	s.version = ver
 	return nil
 }
 
+func (s *MemoryBrowserStorage) Rollback() error {
+	return s.RollbackContext(context.Background())
+}
+
+// RollbackContext discards the compile in progress.
+func (s *MemoryBrowserStorage) RollbackContext(_ context.Context) error {
+	s.stagedNodes = nil
+	s.stagedIndex = nil
+	return nil
+}
+
 func (s *MemoryBrowserStorage) hash(pattern string) uint64 {
 	return xxh3.Hash([]byte(pattern))
 }
 
 func (s *MemoryBrowserStorage) Save(node *BrowserNode) error {
-	hash := s.hash(node.Pattern)
-	s.browsers[hash] = node
+	return s.SaveContext(context.Background(), node)
+}
+
+// SaveContext adds the browser to the compile in progress. Without one, it goes straight to the served browsers.
+func (s *MemoryBrowserStorage) SaveContext(_ context.Context, node *BrowserNode) error {
+	if s.stagedIndex != nil {
+		return saveMemoryNode(&s.stagedNodes, s.stagedIndex, s.hash(node.Pattern), node)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return saveMemoryNode(&s.nodes, s.index, s.hash(node.Pattern), node)
+}
+
+func saveMemoryNode(nodes *[]*BrowserNode, index map[uint64]int, hash uint64, node *BrowserNode) error {
+	i, ok := index[hash]
+	if !ok {
+		index[hash] = len(*nodes)
+		*nodes = append(*nodes, node)
+		return nil
+	}
+
+	if (*nodes)[i].Pattern != node.Pattern {
+		return fmt.Errorf("%w: %s and %s", ErrHashCollision, (*nodes)[i].Pattern, node.Pattern)
+	}
+
+	(*nodes)[i] = node
 	return nil
 }
 
+// lookup must be called with mu held.
+func (s *MemoryBrowserStorage) lookup(pattern string) (*BrowserNode, bool) {
+	i, ok := s.index[s.hash(pattern)]
+	if !ok || s.nodes[i].Pattern != pattern {
+		return nil, false
+	}
+
+	return s.nodes[i], true
+}
+
 func (s *MemoryBrowserStorage) Get(pattern string) (*BrowserNode, error) {
-	hash := s.hash(pattern)
-	node, ok := s.browsers[hash]
+	return s.GetContext(context.Background(), pattern)
+}
+
+func (s *MemoryBrowserStorage) GetContext(_ context.Context, pattern string) (*BrowserNode, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	node, ok := s.lookup(pattern)
 	if !ok {
-		return nil, fmt.Errorf("pattern not found")
+		return nil, ErrPatternNotFound
 	}
 
 	return node, nil
 }
 
+func (s *MemoryBrowserStorage) GetMany(patterns []string) (map[string]*BrowserNode, error) {
+	return s.GetManyContext(context.Background(), patterns)
+}
+
+func (s *MemoryBrowserStorage) GetManyContext(_ context.Context, patterns []string) (map[string]*BrowserNode, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	res := make(map[string]*BrowserNode, len(patterns))
+	for _, pattern := range patterns {
+		if node, ok := s.lookup(pattern); ok {
+			res[pattern] = node
+		}
+	}
+
+	return res, nil
+}
+
 func (s *MemoryBrowserStorage) Patterns() iter.Seq2[string, error] {
+	return s.PatternsContext(context.Background())
+}
+
+func (s *MemoryBrowserStorage) PatternsContext(ctx context.Context) iter.Seq2[string, error] {
 	return func(yield func(string, error) bool) {
-		for _, b := range s.browsers {
-			if !yield(b.Pattern, nil) {
+		// the patterns are copied, so that the consumer may use the storage while iterating
+		s.mu.RLock()
+		patterns := make([]string, 0, len(s.nodes))
+		for _, b := range s.nodes {
+			patterns = append(patterns, b.Pattern)
+		}
+		s.mu.RUnlock()
+
+		for _, pattern := range patterns {
+			if err := ctx.Err(); err != nil {
+				yield("", err)
+				return
+			}
+
+			if !yield(pattern, nil) {
 				return
 			}
 		}
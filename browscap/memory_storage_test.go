@@ -0,0 +1,153 @@
+package browscap
+
+import (
+	"bytes"
+	"errors"
+	"github.com/magiconair/properties/assert"
+	"sync"
+	"testing"
+)
+
+// TestMemoryBrowserStorageConcurrency is meant to be run with the race detector.
+func TestMemoryBrowserStorageConcurrency(t *testing.T) {
+	storage := NewMemoryBrowserStorage()
+
+	err := NewLoader(storage).Compile("fixtures/lite_php_browscap.ini")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bc, err := NewLoader(storage).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				// the previous data is served while the storage is being recompiled
+				_, err := bc.GetBrowser(testUserAgent)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				_, err = storage.GetVersion()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+
+	err = NewLoader(storage, WithRecompile(RecompileForce)).Compile("fixtures/lite_php_browscap.ini")
+	close(done)
+	wg.Wait()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = bc.GetBrowser(testUserAgent)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemoryBrowserStorageFailedCompile(t *testing.T) {
+	storage := NewMemoryBrowserStorage()
+
+	err := NewLoader(storage).CompileReader(bytes.NewReader(fixtureWithVersion(t, "6001007")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	broken := append(fixtureWithVersion(t, "6001008"), []byte("\n[Broken]\nBrowser_Bits=\"abc\"\n")...)
+	err = NewLoader(storage, WithRecompile(RecompileNewer)).CompileReader(bytes.NewReader(broken))
+	if err == nil {
+		t.Fatal("expected error compiling broken file")
+	}
+
+	ver, err := storage.GetVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, ver.Version, 6001007)
+
+	bc, err := NewLoader(storage).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := bc.GetBrowser(testUserAgent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, b.Browser, "Chrome")
+	assert.Equal(t, bc.PatternCount(), 9977)
+}
+
+func TestMemoryBrowserStorageHashCollision(t *testing.T) {
+	storage := NewMemoryBrowserStorage()
+
+	err := storage.Save(&BrowserNode{Pattern: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// pretend "other" shares the hash of "pattern"
+	storage.index[storage.hash("pattern")] = storage.index[storage.hash("other")]
+
+	_, err = storage.Get("pattern")
+	if !errors.Is(err, ErrPatternNotFound) {
+		t.Fatalf("expected ErrPatternNotFound, got %v", err)
+	}
+
+	nodes, err := storage.GetMany([]string{"pattern"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(nodes), 0)
+
+	err = storage.Save(&BrowserNode{Pattern: "pattern"})
+	if !errors.Is(err, ErrHashCollision) {
+		t.Fatalf("expected ErrHashCollision, got %v", err)
+	}
+}
+
+func TestMemoryBrowserStoragePatternOrder(t *testing.T) {
+	collect := func(storage BrowserStorage) []string {
+		err := NewLoader(storage).Compile("fixtures/lite_php_browscap.ini")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var patterns []string
+		for pattern, err := range storage.Patterns() {
+			if err != nil {
+				t.Fatal(err)
+			}
+			patterns = append(patterns, pattern)
+		}
+
+		return patterns
+	}
+
+	db := openSqlite(t)
+
+	memory := collect(NewMemoryBrowserStorage())
+
+	assert.Equal(t, memory, collect(NewMemoryBrowserStorage()))
+	assert.Equal(t, memory, collect(NewSqliteBrowserStorage(db)))
+}
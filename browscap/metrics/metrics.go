@@ -0,0 +1,296 @@
+// Package metrics exposes Prometheus metrics of browser lookups and storage reads.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/eugeniypetrov/browscap-go/browscap"
+	"github.com/prometheus/client_golang/prometheus"
+	"iter"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	resultFound    = "found"
+	resultNotFound = "not_found"
+	resultDefault  = "default"
+	resultError    = "error"
+)
+
+type Metrics struct {
+	lookups      *prometheus.HistogramVec
+	storageGets  *prometheus.HistogramVec
+	patternCount prometheus.Gauge
+	version      prometheus.Gauge
+}
+
+// New creates the collectors and registers them with reg.
+func New(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		lookups: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "browscap",
+			Name:      "lookup_duration_seconds",
+			Help:      "Duration of user agent lookups by result (found, not_found, default, error).",
+			Buckets:   []float64{.00001, .000025, .00005, .0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1},
+		}, []string{"result"}),
+		storageGets: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "browscap",
+			Name:      "storage_get_duration_seconds",
+			Help:      "Duration of browser storage reads by result (found, not_found, error).",
+			Buckets:   []float64{.00001, .000025, .00005, .0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1},
+		}, []string{"result"}),
+		patternCount: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "browscap",
+			Name:      "patterns",
+			Help:      "Number of patterns in the search tree of the loaded Browscap.",
+		}),
+		version: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "browscap",
+			Name:      "version",
+			Help:      "Version of the loaded Browscap.",
+		}),
+	}
+
+	for _, c := range []prometheus.Collector{m.lookups, m.storageGets, m.patternCount, m.version} {
+		err := reg.Register(c)
+		if err != nil {
+			return nil, fmt.Errorf("error registering collector: %w", err)
+		}
+	}
+
+	return m, nil
+}
+
+// ObserveBrowscap sets the version and pattern count gauges from bc.
+func (m *Metrics) ObserveBrowscap(bc *browscap.Browscap) {
+	if ver := bc.Version(); ver != nil {
+		m.version.Set(float64(ver.Version))
+	}
+	m.patternCount.Set(float64(bc.PatternCount()))
+}
+
+func lookupResult(err error) string {
+	var warning *browscap.ResolutionWarning
+
+	switch {
+	case err == nil:
+		return resultFound
+	case errors.Is(err, browscap.ErrNotFound):
+		return resultNotFound
+	case errors.As(err, &warning):
+		return resultDefault
+	default:
+		return resultError
+	}
+}
+
+func storageResult(err error) string {
+	switch {
+	case err == nil:
+		return resultFound
+	case errors.Is(err, browscap.ErrPatternNotFound):
+		return resultNotFound
+	default:
+		return resultError
+	}
+}
+
+// browscapper is implemented by getters serving a Browscap that may change, like browscap.Reloader.
+type browscapper interface {
+	Browscap() *browscap.Browscap
+}
+
+// Getter measures the lookups of a browscap.BrowserGetter.
+type Getter struct {
+	getter   browscap.BrowserGetter
+	metrics  *Metrics
+	observed atomic.Pointer[browscap.Browscap]
+}
+
+// WrapGetter measures the lookups of g. When g is a Browscap or serves one like browscap.Reloader does, the version
+// and pattern count gauges follow it.
+func (m *Metrics) WrapGetter(g browscap.BrowserGetter) *Getter {
+	res := &Getter{
+		getter:  g,
+		metrics: m,
+	}
+	res.observe()
+
+	return res
+}
+
+func (g *Getter) observe() {
+	var bc *browscap.Browscap
+	switch v := g.getter.(type) {
+	case *browscap.Browscap:
+		bc = v
+	case browscapper:
+		bc = v.Browscap()
+	default:
+		return
+	}
+
+	if old := g.observed.Swap(bc); old != bc {
+		g.metrics.ObserveBrowscap(bc)
+	}
+}
+
+func (g *Getter) GetBrowser(ua string) (*browscap.Browser, error) {
+	return g.GetBrowserContext(context.Background(), ua)
+}
+
+func (g *Getter) GetBrowserContext(ctx context.Context, ua string) (*browscap.Browser, error) {
+	g.observe()
+
+	start := time.Now()
+	browser, err := g.getter.GetBrowserContext(ctx, ua)
+	g.metrics.lookups.WithLabelValues(lookupResult(err)).Observe(time.Since(start).Seconds())
+
+	return browser, err
+}
+
+// Storage measures the reads of a browscap.BrowserStorage. Batch reads are forwarded when the storage supports
+// them and count as a single read.
+type Storage struct {
+	storage browscap.BrowserStorage
+	metrics *Metrics
+}
+
+func (m *Metrics) WrapStorage(s browscap.BrowserStorage) *Storage {
+	return &Storage{
+		storage: s,
+		metrics: m,
+	}
+}
+
+func (s *Storage) observe(start time.Time, err error) {
+	s.metrics.storageGets.WithLabelValues(storageResult(err)).Observe(time.Since(start).Seconds())
+}
+
+func (s *Storage) Pin() (browscap.BrowserStorage, int64, error) {
+	return s.PinContext(context.Background())
+}
+
+// PinContext measures the reads of a view pinned to the active generation of the underlying storage, or returns the
+// Storage itself when the underlying storage is not a browscap.Pinner.
+func (s *Storage) PinContext(ctx context.Context) (browscap.BrowserStorage, int64, error) {
+	p, ok := s.storage.(browscap.Pinner)
+	if !ok {
+		return s, 0, nil
+	}
+
+	storage, generation, err := p.PinContext(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return s.metrics.WrapStorage(storage), generation, nil
+}
+
+func (s *Storage) Prepare() error {
+	return s.storage.Prepare()
+}
+
+func (s *Storage) PrepareContext(ctx context.Context) error {
+	return s.storage.PrepareContext(ctx)
+}
+
+func (s *Storage) GetVersion() (*browscap.Version, error) {
+	return s.storage.GetVersion()
+}
+
+func (s *Storage) GetVersionContext(ctx context.Context) (*browscap.Version, error) {
+	return s.storage.GetVersionContext(ctx)
+}
+
+func (s *Storage) SaveVersion(ver *browscap.Version) error {
+	return s.storage.SaveVersion(ver)
+}
+
+func (s *Storage) SaveVersionContext(ctx context.Context, ver *browscap.Version) error {
+	return s.storage.SaveVersionContext(ctx, ver)
+}
+
+func (s *Storage) Save(node *browscap.BrowserNode) error {
+	return s.storage.Save(node)
+}
+
+func (s *Storage) SaveContext(ctx context.Context, node *browscap.BrowserNode) error {
+	return s.storage.SaveContext(ctx, node)
+}
+
+func (s *Storage) Get(pattern string) (*browscap.BrowserNode, error) {
+	return s.GetContext(context.Background(), pattern)
+}
+
+func (s *Storage) GetContext(ctx context.Context, pattern string) (*browscap.BrowserNode, error) {
+	start := time.Now()
+	node, err := s.storage.GetContext(ctx, pattern)
+	s.observe(start, err)
+
+	return node, err
+}
+
+func (s *Storage) GetMany(patterns []string) (map[string]*browscap.BrowserNode, error) {
+	return s.GetManyContext(context.Background(), patterns)
+}
+
+func (s *Storage) GetManyContext(ctx context.Context, patterns []string) (map[string]*browscap.BrowserNode, error) {
+	bs, ok := s.storage.(browscap.BatchBrowserStorage)
+	if !ok {
+		res := make(map[string]*browscap.BrowserNode, len(patterns))
+		for _, pattern := range patterns {
+			node, err := s.GetContext(ctx, pattern)
+			if errors.Is(err, browscap.ErrPatternNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			res[pattern] = node
+		}
+
+		return res, nil
+	}
+
+	start := time.Now()
+	nodes, err := bs.GetManyContext(ctx, patterns)
+	s.observe(start, err)
+
+	return nodes, err
+}
+
+func (s *Storage) Patterns() iter.Seq2[string, error] {
+	return s.storage.Patterns()
+}
+
+func (s *Storage) PatternsContext(ctx context.Context) iter.Seq2[string, error] {
+	return s.storage.PatternsContext(ctx)
+}
+
+func (s *Storage) Rollback() error {
+	return s.RollbackContext(context.Background())
+}
+
+func (s *Storage) RollbackContext(ctx context.Context) error {
+	if r, ok := s.storage.(browscap.Rollbacker); ok {
+		return r.RollbackContext(ctx)
+	}
+
+	return nil
+}
+
+func (s *Storage) Prune(keep int) error {
+	return s.PruneContext(context.Background(), keep)
+}
+
+func (s *Storage) PruneContext(ctx context.Context, keep int) error {
+	p, ok := s.storage.(browscap.Pruner)
+	if !ok {
+		return fmt.Errorf("storage does not keep previous generations")
+	}
+
+	return p.PruneContext(ctx, keep)
+}
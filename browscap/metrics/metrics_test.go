@@ -0,0 +1,155 @@
+package metrics
+
+import (
+	"context"
+	"github.com/eugeniypetrov/browscap-go/browscap"
+	"github.com/eugeniypetrov/browscap-go/browscap/internal/browscaptest"
+	"github.com/jmoiron/sqlx"
+	"github.com/magiconair/properties/assert"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type getterFunc func(ctx context.Context, ua string) (*browscap.Browser, error)
+
+func (f getterFunc) GetBrowserContext(ctx context.Context, ua string) (*browscap.Browser, error) {
+	return f(ctx, ua)
+}
+
+func sampleCount(t *testing.T, reg *prometheus.Registry, name string, result string) uint64 {
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "result" && l.GetValue() == result {
+					return m.GetHistogram().GetSampleCount()
+				}
+			}
+		}
+	}
+
+	return 0
+}
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := New(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage := m.WrapStorage(browscap.NewMemoryBrowserStorage())
+	loader := browscap.NewLoader(storage)
+
+	err = loader.Compile("../fixtures/lite_php_browscap.ini")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bc, err := loader.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := m.WrapGetter(bc)
+
+	assert.Equal(t, testutil.ToFloat64(m.version), float64(6001007))
+	assert.Equal(t, testutil.ToFloat64(m.patternCount), float64(bc.PatternCount()))
+
+	b, err := g.GetBrowser(browscaptest.UserAgent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, b.Browser, "Chrome")
+
+	_, err = storage.Get("no such pattern")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	assert.Equal(t, sampleCount(t, reg, "browscap_lookup_duration_seconds", resultFound), uint64(1))
+	assert.Equal(t, sampleCount(t, reg, "browscap_storage_get_duration_seconds", resultNotFound), uint64(1))
+	if sampleCount(t, reg, "browscap_storage_get_duration_seconds", resultFound) == 0 {
+		t.Fatal("expected storage reads to be measured")
+	}
+
+	notFound := m.WrapGetter(getterFunc(func(context.Context, string) (*browscap.Browser, error) {
+		return &browscap.Browser{}, browscap.ErrNotFound
+	}))
+
+	_, _ = notFound.GetBrowser("")
+	assert.Equal(t, sampleCount(t, reg, "browscap_lookup_duration_seconds", resultNotFound), uint64(1))
+
+	_, err = New(reg)
+	if err == nil {
+		t.Fatal("expected error registering the collectors twice")
+	}
+}
+
+func TestStoragePin(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file:"+filepath.Join(t.TempDir(), "browscap.sqlite")+"?_sync=OFF&_journal=MEMORY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	reg := prometheus.NewRegistry()
+	m, err := New(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage := m.WrapStorage(browscap.NewSqliteBrowserStorage(db))
+	loader := browscap.NewLoader(storage)
+
+	err = loader.Compile("../fixtures/lite_php_browscap.ini")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bc, err := loader.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the new version knows nothing about Chrome
+	err = browscap.NewLoader(storage, browscap.WithRecompile(browscap.RecompileNewer)).
+		CompileReader(strings.NewReader(`
+[GJK_Browscap_Version]
+Version=6001008
+Format=php
+Type=LITE
+
+[DefaultProperties]
+Browser="DefaultProperties"
+
+[*]
+Parent="DefaultProperties"
+Browser="Default Browser"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := bc.GetBrowser(browscaptest.UserAgent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, b.Browser, "Chrome")
+
+	// the Browscap reads through a pinned view, which has to be measured as well
+	if sampleCount(t, reg, "browscap_storage_get_duration_seconds", resultFound) == 0 {
+		t.Fatal("expected storage reads to be measured")
+	}
+}
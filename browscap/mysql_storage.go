@@ -1,6 +1,7 @@
 package browscap
 
 import (
+	"context"
 	"fmt"
 	"github.com/jmoiron/sqlx"
 )
@@ -18,14 +19,14 @@ func NewMysqlBrowserStorage(db *sqlx.DB) *MysqlBrowserStorage {
 	return s
 }
 
-func (s *MysqlBrowserStorage) CreateTable(name string, columns string) error {
+func (s *MysqlBrowserStorage) CreateTable(ctx context.Context, name string, columns string) error {
 	query := fmt.Sprintf(`
 		CREATE TABLE %s (%s) ENGINE=InnoDB ROW_FORMAT=COMPRESSED`,
 		s.QuoteMeta(name),
 		columns,
 	)
 
-	_, err := s.db.Exec(query)
+	_, err := s.db.ExecContext(ctx, query)
 	return err
 }
 
@@ -33,21 +34,30 @@ func (s *MysqlBrowserStorage) QuoteMeta(m string) string {
 	return fmt.Sprintf("`%s`", m)
 }
 
-func (s *MysqlBrowserStorage) InsertIgnore(table string, columns []string, data any) error {
-	_, err := s.db.NamedExec(
-		fmt.Sprintf("INSERT IGNORE INTO %s (%s) VALUES (%s)",
-			table,
+func (s *MysqlBrowserStorage) InsertIgnore(
+	ctx context.Context,
+	tx *sqlx.Tx,
+	table string,
+	columns []string,
+	rows [][]any,
+) error {
+	values, args := s.rowsToPlaceholders(rows)
+	_, err := tx.ExecContext(
+		ctx,
+		fmt.Sprintf("INSERT IGNORE INTO %s (%s) VALUES %s",
+			s.QuoteMeta(table),
 			s.columnsToSql(columns),
-			s.columnsToPlaceholders(columns),
+			values,
 		),
-		data,
+		args...,
 	)
 	return err
 }
 
-func (s *MysqlBrowserStorage) TableExists(table string) (bool, error) {
+func (s *MysqlBrowserStorage) TableExists(ctx context.Context, table string) (bool, error) {
 	var tableExists bool
-	err := s.db.Get(
+	err := s.db.GetContext(
+		ctx,
 		&tableExists,
 		`SELECT COUNT(*) > 0 FROM information_schema.TABLES WHERE TABLE_SCHEMA = SCHEMA() AND TABLE_NAME = ?`,
 		table,
@@ -0,0 +1,70 @@
+package browscap
+
+import "go.opentelemetry.io/otel/trace"
+
+// RecompileMode tells the Loader what to do when the cache already holds a different version.
+type RecompileMode int
+
+const (
+	// RecompileNever refuses to compile over a cache holding a different version.
+	RecompileNever RecompileMode = iota
+	// RecompileNewer replaces the cache when the ini file is newer.
+	RecompileNewer
+	// RecompileForce replaces the cache even when it already holds the same version.
+	RecompileForce
+)
+
+type options struct {
+	resolutionPolicy ResolutionPolicy
+	recompileMode    RecompileMode
+	allowDowngrade   bool
+	flatten          bool
+	tracer           trace.Tracer
+}
+
+// Option configures a Loader or a Browscap. Options passed to NewLoader are also applied to every Browscap it loads.
+type Option func(*options)
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		resolutionPolicy: ResolveStrict,
+		tracer:           noopTracer,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// WithResolutionPolicy sets what happens when the best matching pattern cannot be resolved.
+func WithResolutionPolicy(p ResolutionPolicy) Option {
+	return func(o *options) {
+		o.resolutionPolicy = p
+	}
+}
+
+// WithRecompile sets when Loader.Compile replaces a cache that already holds a different version.
+func WithRecompile(mode RecompileMode) Option {
+	return func(o *options) {
+		o.recompileMode = mode
+	}
+}
+
+// WithAllowDowngrade lets Loader.Compile replace the cache with an older version. It has no effect with
+// RecompileNever.
+func WithAllowDowngrade(allow bool) Option {
+	return func(o *options) {
+		o.allowDowngrade = allow
+	}
+}
+
+// WithFlatten makes Loader.Compile resolve the inheritance once and store fully merged records, so that a lookup
+// needs a single storage read. The compile keeps the merged records in memory until it is finished. The inheritance
+// is lost, so Browscap.Explain attributes every field to the matched pattern.
+func WithFlatten(flatten bool) Option {
+	return func(o *options) {
+		o.flatten = flatten
+	}
+}
@@ -1,8 +1,10 @@
 package browscap
 
 import (
+	"context"
 	"fmt"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type PostgresBrowserStorage struct {
@@ -18,14 +20,14 @@ func NewPostgresBrowserStorage(db *sqlx.DB) *PostgresBrowserStorage {
 	return s
 }
 
-func (s *PostgresBrowserStorage) CreateTable(name string, columns string) error {
+func (s *PostgresBrowserStorage) CreateTable(ctx context.Context, name string, columns string) error {
 	query := fmt.Sprintf(`
 		CREATE TABLE %s (%s)`,
 		s.QuoteMeta(name),
 		columns,
 	)
 
-	_, err := s.db.Exec(query)
+	_, err := s.db.ExecContext(ctx, query)
 	return err
 }
 
@@ -33,21 +35,40 @@ func (s *PostgresBrowserStorage) QuoteMeta(m string) string {
 	return fmt.Sprintf("\"%s\"", m)
 }
 
-func (s *PostgresBrowserStorage) InsertIgnore(table string, columns []string, data any) error {
-	_, err := s.db.NamedExec(
-		fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT DO NOTHING",
-			table,
-			s.columnsToSql(columns),
-			s.columnsToPlaceholders(columns),
-		),
-		data,
-	)
-	return err
+// InsertIgnore loads rows with COPY, which is much faster than INSERT. COPY has no way to skip conflicting rows, but
+// AbstractDBStorage never passes duplicates.
+func (s *PostgresBrowserStorage) InsertIgnore(
+	ctx context.Context,
+	tx *sqlx.Tx,
+	table string,
+	columns []string,
+	rows [][]any,
+) error {
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(table, columns...))
+	if err != nil {
+		return fmt.Errorf("error preparing copy: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, row := range rows {
+		_, err = stmt.ExecContext(ctx, row...)
+		if err != nil {
+			return fmt.Errorf("error copying row: %w", err)
+		}
+	}
+
+	_, err = stmt.ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("error flushing copy: %w", err)
+	}
+
+	return nil
 }
 
-func (s *PostgresBrowserStorage) TableExists(table string) (bool, error) {
+func (s *PostgresBrowserStorage) TableExists(ctx context.Context, table string) (bool, error) {
 	var tableExists bool
-	err := s.db.Get(
+	err := s.db.GetContext(
+		ctx,
 		&tableExists,
 		`SELECT count(*) > 0 FROM information_schema.tables WHERE table_schema = current_schema AND table_name = $1`,
 		table,
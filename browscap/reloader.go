@@ -0,0 +1,146 @@
+package browscap
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type ReloaderOption func(*Reloader)
+
+// WithOnReload sets a callback called after a new version has been swapped in.
+func WithOnReload(fn func(ver *Version)) ReloaderOption {
+	return func(r *Reloader) {
+		r.onReload = fn
+	}
+}
+
+// WithOnReloadError sets a callback called when a periodic reload fails. The previous Browscap keeps serving.
+func WithOnReloadError(fn func(err error)) ReloaderOption {
+	return func(r *Reloader) {
+		r.onError = fn
+	}
+}
+
+type loaded struct {
+	browscap   *Browscap
+	version    Version
+	generation int64
+}
+
+// Reloader holds a Browscap for long-running processes. It polls the storage and, once a new compile has been
+// activated, builds a new Browscap in the background and atomically swaps it in, so lookups never wait for a reload.
+// A compile is detected by its version and, for storages implementing Pinner, by its generation, so that forced
+// recompiles of the same version are picked up too.
+type Reloader struct {
+	loader   *Loader
+	interval time.Duration
+	current  atomic.Pointer[loaded]
+	// mu serializes reloads
+	mu       sync.Mutex
+	onReload func(ver *Version)
+	onError  func(err error)
+}
+
+// NewReloader loads the Browscap and returns a Reloader polling the storage every interval once Run is called.
+func NewReloader(ctx context.Context, loader *Loader, interval time.Duration, opts ...ReloaderOption) (*Reloader, error) {
+	r := &Reloader{
+		loader:   loader,
+		interval: interval,
+		onReload: func(*Version) {},
+		onError:  func(error) {},
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	_, err := r.Reload(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error loading browscap: %w", err)
+	}
+
+	return r, nil
+}
+
+// Reload loads a new Browscap if the storage holds a different compile than the loaded one and reports whether it
+// did.
+func (r *Reloader) Reload(ctx context.Context) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	storage, generation, err := r.loader.pin(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	ver, err := storage.GetVersionContext(ctx)
+	if err != nil {
+		return false, fmt.Errorf("error getting version: %w", err)
+	}
+
+	if cur := r.current.Load(); cur != nil && cur.version == *ver && cur.generation == generation {
+		return false, nil
+	}
+
+	bc, err := r.loader.LoadContext(ctx)
+	if err != nil {
+		return false, fmt.Errorf("error loading version %d: %w", ver.Version, err)
+	}
+
+	r.current.Store(&loaded{
+		browscap:   bc,
+		version:    *bc.version,
+		generation: bc.generation,
+	})
+
+	r.onReload(bc.version)
+
+	return true, nil
+}
+
+// Run polls the storage until ctx is done.
+func (r *Reloader) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, err := r.Reload(ctx)
+			if err != nil && ctx.Err() == nil {
+				r.onError(err)
+			}
+		}
+	}
+}
+
+// Browscap returns the currently loaded Browscap.
+func (r *Reloader) Browscap() *Browscap {
+	return r.current.Load().browscap
+}
+
+// Version returns the version of the currently loaded Browscap.
+func (r *Reloader) Version() Version {
+	return r.current.Load().version
+}
+
+func (r *Reloader) GetBrowser(ua string) (*Browser, error) {
+	return r.Browscap().GetBrowser(ua)
+}
+
+func (r *Reloader) GetBrowserContext(ctx context.Context, ua string) (*Browser, error) {
+	return r.Browscap().GetBrowserContext(ctx, ua)
+}
+
+func (r *Reloader) GetBrowsers(uas []string) ([]*Browser, []error) {
+	return r.Browscap().GetBrowsers(uas)
+}
+
+func (r *Reloader) GetBrowsersContext(ctx context.Context, uas []string) ([]*Browser, []error) {
+	return r.Browscap().GetBrowsersContext(ctx, uas)
+}
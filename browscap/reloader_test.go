@@ -0,0 +1,80 @@
+package browscap
+
+import (
+	"bytes"
+	"context"
+	"github.com/magiconair/properties/assert"
+	"testing"
+	"time"
+)
+
+func TestReloader(t *testing.T) {
+	db := openSqlite(t)
+
+	storage := NewSqliteBrowserStorage(db)
+
+	err := NewLoader(storage).CompileReader(bytes.NewReader(fixtureWithVersion(t, "6001007")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := make(chan *Version, 1)
+	r, err := NewReloader(
+		context.Background(),
+		NewLoader(storage),
+		10*time.Millisecond,
+		WithOnReload(func(ver *Version) {
+			reloaded <- ver
+		}),
+		WithOnReloadError(func(err error) {
+			t.Error(err)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, (<-reloaded).Version, 6001007)
+	assert.Equal(t, r.Version().Version, 6001007)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+
+	err = NewLoader(storage, WithRecompile(RecompileNewer)).
+		CompileReader(bytes.NewReader(fixtureWithVersion(t, "6001008")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case ver := <-reloaded:
+		assert.Equal(t, ver.Version, 6001008)
+	case <-time.After(10 * time.Second):
+		t.Fatal("browscap was not reloaded")
+	}
+
+	assert.Equal(t, r.Version().Version, 6001008)
+
+	// a forced recompile of the same version is a new generation
+	err = NewLoader(storage, WithRecompile(RecompileForce)).
+		CompileReader(bytes.NewReader(fixtureWithVersion(t, "6001008")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case ver := <-reloaded:
+		assert.Equal(t, ver.Version, 6001008)
+	case <-time.After(10 * time.Second):
+		t.Fatal("browscap was not reloaded")
+	}
+
+	assert.Equal(t, r.Browscap().generation, int64(3))
+
+	b, err := r.GetBrowser(testUserAgent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, b.Browser, "Chrome")
+}
@@ -0,0 +1,79 @@
+package browscap
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrPatternNotFound is returned by storages when a pattern is not present.
+var ErrPatternNotFound = errors.New("pattern not found")
+
+// ErrBrokenParentChain is returned when a pattern exists but one of its ancestors does not.
+var ErrBrokenParentChain = errors.New("broken parent chain")
+
+type ResolutionPolicy int
+
+const (
+	// ResolveStrict fails the lookup when the best candidate cannot be resolved.
+	ResolveStrict ResolutionPolicy = iota
+	// ResolveNextCandidate falls through to the next ranked candidate.
+	ResolveNextCandidate
+	// ResolveDefault returns DefaultBrowser along with a *ResolutionWarning.
+	ResolveDefault
+)
+
+// ResolutionWarning is returned together with DefaultBrowser under ResolveDefault policy.
+type ResolutionWarning struct {
+	Pattern string
+	Err     error
+}
+
+func (w *ResolutionWarning) Error() string {
+	return fmt.Sprintf("unable to resolve pattern %s, falling back to default browser: %s", w.Pattern, w.Err)
+}
+
+func (w *ResolutionWarning) Unwrap() error {
+	return w.Err
+}
+
+// isUnresolvable reports whether err is caused by missing data rather than by the storage itself, so that a
+// lookup may recover from it according to the resolution policy.
+func isUnresolvable(err error) bool {
+	return errors.Is(err, ErrPatternNotFound)
+}
+
+// resolve resolves the ranked candidates according to the resolution policy.
+func (b *Browscap) resolve(patterns []string, get func(pattern string) (*BrowserNode, error)) (*Browser, error) {
+	var firstErr error
+
+	for _, p := range patterns {
+		browser, err := b.resolveBrowser(p, get)
+		if err == nil {
+			return browser, nil
+		}
+
+		if !isUnresolvable(err) || b.options.resolutionPolicy == ResolveStrict {
+			return nil, err
+		}
+
+		if firstErr == nil {
+			firstErr = err
+		}
+
+		if b.options.resolutionPolicy == ResolveDefault {
+			break
+		}
+	}
+
+	if b.options.resolutionPolicy == ResolveDefault {
+		res := &BrowserNode{}
+		mergeBrowsers(DefaultBrowser, res)
+
+		return res.ToBrowser(), &ResolutionWarning{
+			Pattern: patterns[0],
+			Err:     firstErr,
+		}
+	}
+
+	return nil, firstErr
+}
@@ -0,0 +1,116 @@
+package browscap
+
+import (
+	"errors"
+	radix "github.com/eugeniypetrov/radix-tree"
+	"github.com/magiconair/properties/assert"
+	"strings"
+	"testing"
+)
+
+func newBrokenChainBrowscap(t *testing.T, opts ...Option) *Browscap {
+	storage := NewMemoryBrowserStorage()
+	tree := radix.NewRadix()
+
+	for _, node := range []*BrowserNode{
+		{Pattern: DefaultPatternName},
+		{Pattern: "*", Parent: DefaultPatternName, Browser: StringPtr("Any")},
+		{Pattern: "*chrome*", Parent: "chrome 128.0"},
+	} {
+		err := storage.Save(node)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree.Add(node.Pattern)
+	}
+
+	return NewBrowscap(tree, storage, opts...)
+}
+
+func TestResolveStrict(t *testing.T) {
+	bc := newBrokenChainBrowscap(t)
+
+	_, err := bc.GetBrowser("Chrome")
+	if !errors.Is(err, ErrBrokenParentChain) {
+		t.Fatalf("expected ErrBrokenParentChain, got %v", err)
+	}
+
+	if !errors.Is(err, ErrPatternNotFound) {
+		t.Fatalf("expected ErrPatternNotFound, got %v", err)
+	}
+}
+
+func TestResolveNextCandidate(t *testing.T) {
+	bc := newBrokenChainBrowscap(t, WithResolutionPolicy(ResolveNextCandidate))
+
+	b, err := bc.GetBrowser("Chrome")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, b.Pattern, "*")
+	assert.Equal(t, b.Browser, "Any")
+
+	browsers, errs := bc.GetBrowsers([]string{"Chrome"})
+	assert.Equal(t, errs[0], nil)
+	assert.Equal(t, browsers[0], b)
+}
+
+func TestResolveNextCandidateLimit(t *testing.T) {
+	bc := newBrokenChainBrowscap(t, WithResolutionPolicy(ResolveNextCandidate))
+
+	// the unresolvable best candidate does not count towards the limit
+	matches, err := bc.GetCandidates("Chrome", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, len(matches), 1)
+	assert.Equal(t, matches[0].Pattern, "*")
+	assert.Equal(t, matches[0].Browser.Browser, "Any")
+}
+
+func TestResolveDefault(t *testing.T) {
+	bc := newBrokenChainBrowscap(t, WithResolutionPolicy(ResolveDefault))
+
+	b, err := bc.GetBrowser("Chrome")
+
+	var warning *ResolutionWarning
+	if !errors.As(err, &warning) {
+		t.Fatalf("expected ResolutionWarning, got %v", err)
+	}
+
+	assert.Equal(t, warning.Pattern, "*chrome*")
+	assert.Equal(t, errors.Is(err, ErrBrokenParentChain), true)
+	assert.Equal(t, b, DefaultBrowser.ToBrowser())
+}
+
+func TestResolveMissingParent(t *testing.T) {
+	loader := NewLoader(NewMemoryBrowserStorage())
+	err := loader.CompileReader(strings.NewReader(`
+[GJK_Browscap_Version]
+Version=6001007
+Format=php
+Type=LITE
+
+[DefaultProperties]
+Browser="DefaultProperties"
+
+[*chrome*]
+Browser="Chrome"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bc, err := loader.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a section without a parent is not a flattened one
+	_, err = bc.GetBrowser("Chrome")
+	if !errors.Is(err, ErrBrokenParentChain) {
+		t.Fatalf("expected ErrBrokenParentChain, got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package browscap
 
 import (
+	"context"
 	"fmt"
 	"github.com/jmoiron/sqlx"
 )
@@ -18,14 +19,14 @@ func NewSqliteBrowserStorage(db *sqlx.DB) *SqliteBrowserStorage {
 	return s
 }
 
-func (s *SqliteBrowserStorage) CreateTable(name string, columns string) error {
+func (s *SqliteBrowserStorage) CreateTable(ctx context.Context, name string, columns string) error {
 	query := fmt.Sprintf(`
 		CREATE TABLE %s (%s)`,
 		s.QuoteMeta(name),
 		columns,
 	)
 
-	_, err := s.db.Exec(query)
+	_, err := s.db.ExecContext(ctx, query)
 	return err
 }
 
@@ -33,21 +34,30 @@ func (s *SqliteBrowserStorage) QuoteMeta(m string) string {
 	return m
 }
 
-func (s *SqliteBrowserStorage) InsertIgnore(table string, columns []string, data any) error {
-	_, err := s.db.NamedExec(
-		fmt.Sprintf("INSERT OR IGNORE INTO %s (%s) VALUES (%s)",
-			table,
+func (s *SqliteBrowserStorage) InsertIgnore(
+	ctx context.Context,
+	tx *sqlx.Tx,
+	table string,
+	columns []string,
+	rows [][]any,
+) error {
+	values, args := s.rowsToPlaceholders(rows)
+	_, err := tx.ExecContext(
+		ctx,
+		fmt.Sprintf("INSERT OR IGNORE INTO %s (%s) VALUES %s",
+			s.QuoteMeta(table),
 			s.columnsToSql(columns),
-			s.columnsToPlaceholders(columns),
+			values,
 		),
-		data,
+		args...,
 	)
 	return err
 }
 
-func (s *SqliteBrowserStorage) TableExists(table string) (bool, error) {
+func (s *SqliteBrowserStorage) TableExists(ctx context.Context, table string) (bool, error) {
 	var tableExists bool
-	err := s.db.Get(
+	err := s.db.GetContext(
+		ctx,
 		&tableExists,
 		`SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = ?`,
 		table,
@@ -1,12 +1,53 @@
 package browscap
 
-import "iter"
+import (
+	"context"
+	"errors"
+	"iter"
+)
+
+// ErrHashCollision is returned while compiling when two different patterns share the hash a storage keys them by.
+var ErrHashCollision = errors.New("hash collision")
 
 type BrowserStorage interface {
+	// Prepare readies the storage for a fresh compile replacing any previously cached data
 	Prepare() error
+	PrepareContext(ctx context.Context) error
 	GetVersion() (*Version, error)
+	GetVersionContext(ctx context.Context) (*Version, error)
 	SaveVersion(ver *Version) error
+	SaveVersionContext(ctx context.Context, ver *Version) error
 	Save(node *BrowserNode) error
+	SaveContext(ctx context.Context, node *BrowserNode) error
 	Get(pattern string) (*BrowserNode, error)
+	GetContext(ctx context.Context, pattern string) (*BrowserNode, error)
 	Patterns() iter.Seq2[string, error]
+	PatternsContext(ctx context.Context) iter.Seq2[string, error]
+}
+
+// BatchBrowserStorage is implemented by storages that can fetch several patterns in a single round trip.
+// Patterns that are not found are omitted from the resulting map.
+type BatchBrowserStorage interface {
+	GetMany(patterns []string) (map[string]*BrowserNode, error)
+	GetManyContext(ctx context.Context, patterns []string) (map[string]*BrowserNode, error)
+}
+
+// Pruner is implemented by storages that keep previous compiles around.
+type Pruner interface {
+	Prune(keep int) error
+	PruneContext(ctx context.Context, keep int) error
+}
+
+// Rollbacker is implemented by storages that have to clean up after a failed compile.
+type Rollbacker interface {
+	Rollback() error
+	RollbackContext(ctx context.Context) error
+}
+
+// Pinner is implemented by storages that keep several compiles around, see AbstractDBStorage.
+type Pinner interface {
+	// Pin returns a view reading the compile active at the time of the call, even after a newer one has been
+	// activated, along with the generation identifying that compile. Every compile gets a new generation.
+	Pin() (BrowserStorage, int64, error)
+	PinContext(ctx context.Context) (BrowserStorage, int64, error)
 }
@@ -0,0 +1,43 @@
+package browscap
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const tracerName = "github.com/eugeniypetrov/browscap-go/browscap"
+
+// Span attributes
+const (
+	attrCandidates = attribute.Key("browscap.candidates")
+	attrPattern    = attribute.Key("browscap.pattern")
+	attrNodesRead  = attribute.Key("browscap.nodes_read")
+	attrPatterns   = attribute.Key("browscap.patterns")
+	attrUserAgents = attribute.Key("browscap.user_agents")
+	attrVersion    = attribute.Key("browscap.version")
+	attrCompiled   = attribute.Key("browscap.compiled")
+	attrSections   = attribute.Key("browscap.sections")
+	attrDuplicates = attribute.Key("browscap.duplicates")
+)
+
+var noopTracer = noop.NewTracerProvider().Tracer(tracerName)
+
+// WithTracerProvider makes lookups, storage reads, compiles and loads emit OpenTelemetry spans. No spans are emitted
+// by default.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *options) {
+		o.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// endSpan records err, if any, and ends span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
@@ -0,0 +1,70 @@
+package browscap
+
+import (
+	"github.com/magiconair/properties/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+func spanAttributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+
+	return attrs
+}
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	loader := NewLoader(NewMemoryBrowserStorage(), WithTracerProvider(tp))
+	err := loader.Compile("fixtures/lite_php_browscap.ini")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bc, err := loader.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exporter.GetSpans()
+	assert.Equal(t, len(spans), 2)
+	assert.Equal(t, spans[0].Name, "browscap.Compile")
+	assert.Equal(t, spanAttributes(spans[0])[attrSections].AsInt64(), int64(9978))
+	assert.Equal(t, spanAttributes(spans[0])[attrCompiled].AsBool(), true)
+	assert.Equal(t, spans[1].Name, "browscap.Load")
+	assert.Equal(t, spanAttributes(spans[1])[attrPatterns].AsInt64(), int64(bc.PatternCount()))
+
+	exporter.Reset()
+
+	_, err = bc.GetBrowser(testUserAgent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spans = exporter.GetSpans()
+	lookup := spans[len(spans)-1]
+	assert.Equal(t, lookup.Name, "browscap.GetBrowser")
+
+	attrs := spanAttributes(lookup)
+	assert.Equal(t, attrs[attrPattern].AsString(), "mozilla/5.0 (*mac os x*) applewebkit* (*khtml*like*gecko*) chrome/128.0*safari/*")
+
+	var gets []string
+	for _, span := range spans[:len(spans)-1] {
+		assert.Equal(t, span.Parent.SpanID(), lookup.SpanContext.SpanID())
+		if span.Name == "browscap.storage.Get" {
+			gets = append(gets, spanAttributes(span)[attrPattern].AsString())
+		}
+	}
+
+	assert.Equal(t, spans[0].Name, "browscap.Find")
+	assert.Equal(t, spanAttributes(spans[0])[attrCandidates], attrs[attrCandidates])
+	assert.Equal(t, len(gets), len(chain(t, testUserAgent))-1)
+	assert.Equal(t, attrs[attrNodesRead].AsInt64(), int64(len(gets)))
+	assert.Equal(t, gets[len(gets)-1], DefaultPatternName)
+}
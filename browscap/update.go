@@ -0,0 +1,149 @@
+package browscap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultVersionURL  = "https://browscap.org/version-number"
+	DefaultDownloadURL = "https://browscap.org/stream?q=Full_PHP_BrowsCapINI"
+)
+
+// UpdateSource describes where Loader.Update gets new releases from.
+type UpdateSource struct {
+	// VersionURL returns the version number of the latest release as plain text
+	VersionURL string
+	// DownloadURL returns the php ini file of the latest release, optionally compressed
+	DownloadURL string
+	// Client is used for all requests, http.DefaultClient if nil
+	Client *http.Client
+	// ETag and LastModified of the previous version check make it conditional
+	ETag         string
+	LastModified string
+}
+
+// UpdateResult reports what Loader.Update did.
+type UpdateResult struct {
+	// Updated reports whether a new version has been compiled, which is not the case when the download still holds
+	// the cached version
+	Updated       bool
+	RemoteVersion int
+	// ETag and LastModified of the version check response, to be passed to the next update
+	ETag         string
+	LastModified string
+}
+
+func NewUpdateSource() *UpdateSource {
+	return &UpdateSource{
+		VersionURL:  DefaultVersionURL,
+		DownloadURL: DefaultDownloadURL,
+	}
+}
+
+func (s *UpdateSource) client() *http.Client {
+	if s.Client == nil {
+		return http.DefaultClient
+	}
+
+	return s.Client
+}
+
+func (s *UpdateSource) get(ctx context.Context, url string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting %s: %w", url, err)
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotModified {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s from %s", resp.Status, url)
+	}
+
+	return resp, nil
+}
+
+// Update fetches the version number of the latest release and downloads and compiles it only when it is newer than
+// the cached version, replacing the cached one. The version check is conditional when the source carries the ETag
+// or LastModified of a previous check and the cache is not empty.
+func (l *Loader) Update(ctx context.Context, source *UpdateSource) (*UpdateResult, error) {
+	cachedVersion := 0
+	cached, err := l.browserStorage.GetVersionContext(ctx)
+	switch {
+	case err == nil:
+		cachedVersion = cached.Version
+	case !errors.Is(err, ErrEmptyCache):
+		return nil, fmt.Errorf("error getting version from cache: %w", err)
+	}
+
+	header := http.Header{}
+	if cachedVersion > 0 {
+		if source.ETag != "" {
+			header.Set("If-None-Match", source.ETag)
+		}
+		if source.LastModified != "" {
+			header.Set("If-Modified-Since", source.LastModified)
+		}
+	}
+
+	resp, err := source.get(ctx, source.VersionURL, header)
+	if err != nil {
+		return nil, fmt.Errorf("error checking version: %w", err)
+	}
+	defer resp.Body.Close()
+
+	res := &UpdateResult{
+		RemoteVersion: cachedVersion,
+		ETag:          source.ETag,
+		LastModified:  source.LastModified,
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		return res, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64))
+	if err != nil {
+		return nil, fmt.Errorf("error reading version: %w", err)
+	}
+
+	res.RemoteVersion, err = strconv.Atoi(strings.TrimSpace(string(body)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid version %q: %w", body, err)
+	}
+	res.ETag = resp.Header.Get("ETag")
+	res.LastModified = resp.Header.Get("Last-Modified")
+
+	if res.RemoteVersion <= cachedVersion {
+		return res, nil
+	}
+
+	download, err := source.get(ctx, source.DownloadURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading: %w", err)
+	}
+	defer download.Body.Close()
+
+	err = l.compileReader(ctx, download.Body, max(l.options.recompileMode, RecompileNewer))
+	if err != nil {
+		return nil, fmt.Errorf("error compiling: %w", err)
+	}
+
+	res.Updated = l.Stats() != nil
+
+	return res, nil
+}
@@ -0,0 +1,86 @@
+package browscap
+
+import (
+	"context"
+	"github.com/magiconair/properties/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUpdate(t *testing.T) {
+	downloads := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/version-number", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"6001007"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"6001007"`)
+		_, _ = w.Write([]byte("6001007\n"))
+	})
+	mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		http.ServeFile(w, r, "fixtures/lite_php_browscap.ini.bz2")
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	source := &UpdateSource{
+		VersionURL:  srv.URL + "/version-number",
+		DownloadURL: srv.URL + "/stream",
+		Client:      srv.Client(),
+	}
+
+	storage := NewMemoryBrowserStorage()
+	loader := NewLoader(storage)
+
+	res, err := loader.Update(context.Background(), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, res.Updated, true)
+	assert.Equal(t, res.RemoteVersion, 6001007)
+	assert.Equal(t, res.ETag, `"6001007"`)
+	assert.Equal(t, downloads, 1)
+
+	ver, err := storage.GetVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, ver.Version, 6001007)
+
+	// same version, nothing to download
+	res, err = loader.Update(context.Background(), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, res.Updated, false)
+	assert.Equal(t, downloads, 1)
+
+	// conditional version check
+	source.ETag = res.ETag
+	res, err = loader.Update(context.Background(), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, res.Updated, false)
+	assert.Equal(t, res.ETag, `"6001007"`)
+	assert.Equal(t, downloads, 1)
+
+	// a newer version is announced before the download serves it
+	source.VersionURL = srv.URL + "/next-version-number"
+	mux.HandleFunc("/next-version-number", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("6001008\n"))
+	})
+
+	res, err = loader.Update(context.Background(), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, res.Updated, false)
+	assert.Equal(t, res.RemoteVersion, 6001008)
+	assert.Equal(t, downloads, 2)
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/eugeniypetrov/browscap-go/browscap"
@@ -9,13 +11,16 @@ import (
 	_ "github.com/lib/pq"
 	"log"
 	"os"
-	"reflect"
+	"path/filepath"
 	"time"
 )
 
 const (
 	CommandCompile = "compile"
 	CommandFind    = "find"
+	CommandExplain = "explain"
+	CommandUpdate  = "update"
+	CommandPrune   = "prune"
 )
 
 func getStorage(storageName string, dsn string) (browscap.BrowserStorage, error) {
@@ -38,12 +43,85 @@ func getStorage(storageName string, dsn string) (browscap.BrowserStorage, error)
 			return nil, fmt.Errorf("error opening db: %w", err)
 		}
 		return browscap.NewPostgresBrowserStorage(db), nil
+	case "file":
+		return browscap.NewFileBrowserStorage(dsn), nil
+	case "memory":
+		return loadSnapshot(dsn)
 	default:
 		return nil, fmt.Errorf("unknown storage %s", storageName)
 	}
 }
 
-func compile(filename string, storageName string, dsn string) error {
+// loadSnapshot restores the memory storage from the snapshot file, a missing file gives an empty storage.
+func loadSnapshot(filename string) (*browscap.MemoryBrowserStorage, error) {
+	f, err := os.Open(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return browscap.NewMemoryBrowserStorage(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening snapshot: %w", err)
+	}
+	defer f.Close()
+
+	storage, err := browscap.LoadMemoryBrowserStorage(f)
+	if err != nil {
+		return nil, fmt.Errorf("error loading snapshot: %w", err)
+	}
+
+	return storage, nil
+}
+
+// saveSnapshot writes the memory storage back to the snapshot file, other storages persist on their own.
+func saveSnapshot(storage browscap.BrowserStorage, filename string) error {
+	memory, ok := storage.(*browscap.MemoryBrowserStorage)
+	if !ok {
+		return nil
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating snapshot: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	err = f.Chmod(0o644)
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("error creating snapshot: %w", err)
+	}
+
+	err = memory.WriteSnapshot(f)
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("error writing snapshot: %w", err)
+	}
+
+	err = f.Close()
+	if err != nil {
+		return fmt.Errorf("error writing snapshot: %w", err)
+	}
+
+	err = os.Rename(f.Name(), filename)
+	if err != nil {
+		return fmt.Errorf("error replacing snapshot: %w", err)
+	}
+
+	return nil
+}
+
+type batchSizeSetter interface {
+	SetBatchSize(size int)
+}
+
+func compile(
+	filename string,
+	storageName string,
+	dsn string,
+	force bool,
+	allowDowngrade bool,
+	batchSize int,
+	flatten bool,
+) error {
 	log.Println("compiling", filename)
 
 	storage, err := getStorage(storageName, dsn)
@@ -51,14 +129,46 @@ func compile(filename string, storageName string, dsn string) error {
 		return fmt.Errorf("error getting storage: %w", err)
 	}
 
-	l := browscap.NewLoader(storage)
+	if s, ok := storage.(batchSizeSetter); ok {
+		s.SetBatchSize(batchSize)
+	}
+
+	mode := browscap.RecompileNewer
+	if force {
+		mode = browscap.RecompileForce
+	}
+
+	l := browscap.NewLoader(
+		storage,
+		browscap.WithRecompile(mode),
+		browscap.WithAllowDowngrade(allowDowngrade),
+		browscap.WithFlatten(flatten),
+	)
 
 	err = l.Compile(filename)
 	if err != nil {
 		return fmt.Errorf("error compiling: %w", err)
 	}
 
-	return nil
+	stats := l.Stats()
+	if stats == nil {
+		log.Println("already up to date")
+		return nil
+	}
+
+	logStats(stats)
+
+	return saveSnapshot(storage, dsn)
+}
+
+func logStats(stats *browscap.CompileStats) {
+	log.Printf(
+		"compiled version %d: %d sections, %d saved, %d duplicates ignored",
+		stats.Version.Version,
+		stats.Sections,
+		stats.Saved,
+		stats.Duplicates,
+	)
 }
 
 func find(userAgent string, storageName string, dsn string) error {
@@ -86,14 +196,8 @@ func find(userAgent string, storageName string, dsn string) error {
 	}
 	elapsed := time.Since(start)
 
-	b := reflect.ValueOf(browser).Elem()
-	for i := 0; i < b.NumField(); i++ {
-		field := b.Field(i)
-		fmt.Printf(
-			"%-30s %v\n",
-			b.Type().Field(i).Name,
-			field.Interface(),
-		)
+	for _, field := range browser.Fields() {
+		fmt.Printf("%-30s %v\n", field.Name, field.Value)
 	}
 
 	log.Printf("elapsed %s", elapsed)
@@ -101,6 +205,101 @@ func find(userAgent string, storageName string, dsn string) error {
 	return nil
 }
 
+func explain(userAgent string, storageName string, dsn string) error {
+	storage, err := getStorage(storageName, dsn)
+	if err != nil {
+		return fmt.Errorf("error getting storage: %w", err)
+	}
+
+	bc, err := browscap.NewLoader(storage).Load()
+	if err != nil {
+		return fmt.Errorf("error loading: %w", err)
+	}
+
+	e, err := bc.Explain(userAgent)
+
+	fmt.Println("candidates:")
+	for i, c := range e.Candidates {
+		fmt.Printf("  %3d. score %-4d %s\n", i+1, c.Score, c.Pattern)
+	}
+
+	if err != nil {
+		return fmt.Errorf("error explaining: %w", err)
+	}
+
+	fmt.Printf("\nmatched pattern: %s\n", e.Pattern)
+
+	values := make(map[string]any)
+	for _, field := range e.Browser.Fields() {
+		values[field.Name] = field.Value
+	}
+
+	printFields := func(fields []string) {
+		for _, name := range fields {
+			fmt.Printf("    %-30s %v\n", name, values[name])
+		}
+	}
+
+	fmt.Println("\nchain:")
+	for _, link := range e.Chain {
+		fmt.Printf("  %s\n", link.Pattern)
+		printFields(link.Fields)
+	}
+
+	fmt.Println("  (default browser)")
+	printFields(e.DefaultFields)
+
+	return nil
+}
+
+func update(source *browscap.UpdateSource, storageName string, dsn string) error {
+	log.Println("checking", source.VersionURL)
+
+	storage, err := getStorage(storageName, dsn)
+	if err != nil {
+		return fmt.Errorf("error getting storage: %w", err)
+	}
+
+	l := browscap.NewLoader(storage)
+	res, err := l.Update(context.Background(), source)
+	if err != nil {
+		return fmt.Errorf("error updating: %w", err)
+	}
+
+	// pass these to the next update with -etag and -last-modified to make its version check conditional
+	log.Printf("etag %q, last modified %q", res.ETag, res.LastModified)
+
+	stats := l.Stats()
+	if !res.Updated || stats == nil {
+		log.Printf("already up to date (version %d)", res.RemoteVersion)
+		return nil
+	}
+
+	log.Printf("updated to version %d", res.RemoteVersion)
+	logStats(stats)
+
+	return saveSnapshot(storage, dsn)
+}
+
+func prune(storageName string, dsn string, keep int) error {
+	storage, err := getStorage(storageName, dsn)
+	if err != nil {
+		return fmt.Errorf("error getting storage: %w", err)
+	}
+
+	pruner, ok := storage.(browscap.Pruner)
+	if !ok {
+		return fmt.Errorf("storage %s does not keep previous generations", storageName)
+	}
+
+	err = pruner.Prune(keep)
+	if err != nil {
+		return fmt.Errorf("error pruning: %w", err)
+	}
+
+	return nil
+}
+
 func main() {
 	if len(os.Args) < 2 {
 		fmt.Println("expected subcommand")
@@ -112,23 +311,27 @@ func main() {
 	switch cmd {
 	case CommandCompile:
 		fs := flag.NewFlagSet(CommandCompile, flag.ExitOnError)
-		filename := fs.String("filename", "full_php_browscap.ini", "browscap ini file")
-		storage := fs.String("storage", "sqlite", "storage (mysql, sqlite, postgres)")
+		filename := fs.String("filename", "full_php_browscap.ini", "browscap ini file (plain, gzip, bzip2 or zip)")
+		storage := fs.String("storage", "sqlite", "storage (mysql, sqlite, postgres, file, memory)")
 		dsn := fs.String("dsn", "browscap.sqlite", "data source name")
+		force := fs.Bool("force", false, "recompile even if the cache already holds the same version")
+		allowDowngrade := fs.Bool("allow-downgrade", false, "allow replacing the cache with an older version")
+		batchSize := fs.Int("batch-size", browscap.DefaultBatchSize, "number of rows inserted at once")
+		flatten := fs.Bool("flatten", false, "store fully merged records for faster lookups")
 
 		err := fs.Parse(os.Args[2:])
 		if err != nil {
 			log.Fatalf("error parsing compile command. %s", err)
 		}
 
-		err = compile(*filename, *storage, *dsn)
+		err = compile(*filename, *storage, *dsn, *force, *allowDowngrade, *batchSize, *flatten)
 		if err != nil {
 			log.Fatalf("error compiling. %s", err)
 		}
 	case CommandFind:
 		fs := flag.NewFlagSet(CommandFind, flag.ExitOnError)
 		userAgent := fs.String("user-agent", "", "user agent")
-		storage := fs.String("storage", "sqlite", "storage (mysql, sqlite, memory)")
+		storage := fs.String("storage", "sqlite", "storage (mysql, sqlite, postgres, file, memory)")
 		dsn := fs.String("dsn", "browscap.sqlite", "data source name")
 
 		err := fs.Parse(os.Args[2:])
@@ -140,6 +343,55 @@ func main() {
 		if err != nil {
 			log.Fatalf("error finding. %s", err)
 		}
+	case CommandExplain:
+		fs := flag.NewFlagSet(CommandExplain, flag.ExitOnError)
+		userAgent := fs.String("user-agent", "", "user agent")
+		storage := fs.String("storage", "sqlite", "storage (mysql, sqlite, postgres, file, memory)")
+		dsn := fs.String("dsn", "browscap.sqlite", "data source name")
+
+		err := fs.Parse(os.Args[2:])
+		if err != nil {
+			log.Fatalf("error parsing explain command. %s", err)
+		}
+
+		err = explain(*userAgent, *storage, *dsn)
+		if err != nil {
+			log.Fatalf("error explaining. %s", err)
+		}
+	case CommandUpdate:
+		fs := flag.NewFlagSet(CommandUpdate, flag.ExitOnError)
+		source := browscap.NewUpdateSource()
+		fs.StringVar(&source.DownloadURL, "url", browscap.DefaultDownloadURL, "browscap ini file download url")
+		fs.StringVar(&source.VersionURL, "version-url", browscap.DefaultVersionURL, "browscap version number url")
+		fs.StringVar(&source.ETag, "etag", "", "etag of the previous version check")
+		fs.StringVar(&source.LastModified, "last-modified", "", "last modified date of the previous version check")
+		storage := fs.String("storage", "sqlite", "storage (mysql, sqlite, postgres, file, memory)")
+		dsn := fs.String("dsn", "browscap.sqlite", "data source name")
+
+		err := fs.Parse(os.Args[2:])
+		if err != nil {
+			log.Fatalf("error parsing update command. %s", err)
+		}
+
+		err = update(source, *storage, *dsn)
+		if err != nil {
+			log.Fatalf("error updating. %s", err)
+		}
+	case CommandPrune:
+		fs := flag.NewFlagSet(CommandPrune, flag.ExitOnError)
+		storage := fs.String("storage", "sqlite", "storage (mysql, sqlite, postgres, file, memory)")
+		dsn := fs.String("dsn", "browscap.sqlite", "data source name")
+		keep := fs.Int("keep", 1, "number of previous generations to keep")
+
+		err := fs.Parse(os.Args[2:])
+		if err != nil {
+			log.Fatalf("error parsing prune command. %s", err)
+		}
+
+		err = prune(*storage, *dsn, *keep)
+		if err != nil {
+			log.Fatalf("error pruning. %s", err)
+		}
 	default:
 		log.Fatalf("unexpected subcommand %s", cmd)
 	}